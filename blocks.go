@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/lomik/hdfs-fsimage-dump/fsimage"
+)
+
+// blockTable writes one json line per block of a file
+type blockTable struct {
+	sync.Mutex
+	f           io.WriteCloser
+	w           *bufio.Writer
+	jsonEncoder *json.Encoder
+}
+
+func newBlockTable(f io.WriteCloser) *blockTable {
+	w := bufio.NewWriter(f)
+	return &blockTable{f: f, w: w, jsonEncoder: json.NewEncoder(w)}
+}
+
+func (t *blockTable) write(rec *fsimage.Record) error {
+	t.Lock()
+	defer t.Unlock()
+	for _, b := range rec.INode.GetFile().GetBlocks() {
+		err := t.jsonEncoder.Encode(map[string]interface{}{
+			"Id":              rec.Id,
+			"BlockId":         b.GetBlockId(),
+			"GenerationStamp": b.GetGenStamp(),
+			"NumBytes":        b.GetNumBytes(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *blockTable) close() error {
+	if err := t.w.Flush(); err != nil {
+		t.f.Close()
+		return err
+	}
+	return t.f.Close()
+}
+
+// blockList returns the blocks of a file record for the Blocks array
+func blockList(rec *fsimage.Record) []map[string]interface{} {
+	blocks := rec.INode.GetFile().GetBlocks()
+	list := make([]map[string]interface{}, len(blocks))
+	for i, b := range blocks {
+		list[i] = map[string]interface{}{
+			"BlockId":         b.GetBlockId(),
+			"GenerationStamp": b.GetGenStamp(),
+			"NumBytes":        b.GetNumBytes(),
+		}
+	}
+	return list
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/lomik/hdfs-fsimage-dump/fsimage"
+	pbh "github.com/lomik/hdfs-fsimage-dump/pb/hadoop_hdfs"
+	pb "github.com/lomik/hdfs-fsimage-dump/pb/hadoop_hdfs_fsimage"
+)
+
+// fileRecord returns the record of a file with blocks of the given sizes
+func fileRecord(id uint64, sizes ...uint64) *fsimage.Record {
+	f := &pb.INodeSection_INodeFile{}
+	for i, size := range sizes {
+		f.Blocks = append(f.Blocks, &pbh.BlockProto{
+			BlockId:  proto.Uint64(1073741825 + uint64(i)),
+			GenStamp: proto.Uint64(1001 + uint64(i)),
+			NumBytes: proto.Uint64(size),
+		})
+	}
+	return &fsimage.Record{Id: id, Type: pb.INodeSection_INode_FILE, INode: &pb.INodeSection_INode{File: f}}
+}
+
+// bufferCloser is a bytes.Buffer with Close, the error of Write is err
+type bufferCloser struct {
+	bytes.Buffer
+	err    error
+	closed bool
+}
+
+func (b *bufferCloser) Write(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	return b.Buffer.Write(p)
+}
+
+func (b *bufferCloser) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestBlockTable(t *testing.T) {
+	var f bufferCloser
+	table := newBlockTable(&f)
+	for _, rec := range []*fsimage.Record{fileRecord(16386, 10, 20), fileRecord(16387), fileRecord(16388, 0)} {
+		if err := table.write(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := table.close(); err != nil || !f.closed {
+		t.Fatalf("close %v, closed %v", err, f.closed)
+	}
+
+	want := []map[string]interface{}{
+		{"Id": 16386.0, "BlockId": 1073741825.0, "GenerationStamp": 1001.0, "NumBytes": 10.0},
+		{"Id": 16386.0, "BlockId": 1073741826.0, "GenerationStamp": 1002.0, "NumBytes": 20.0},
+		{"Id": 16388.0, "BlockId": 1073741825.0, "GenerationStamp": 1001.0, "NumBytes": 0.0},
+	}
+	if got := jsonLines(t, f.Bytes()); !reflect.DeepEqual(got, want) {
+		t.Errorf("%v\nwant\n%v", got, want)
+	}
+
+	// the buffered write error comes with close
+	broken := &bufferCloser{err: errors.New("disk full")}
+	table = newBlockTable(broken)
+	if err := table.write(fileRecord(16386, 10)); err != nil {
+		t.Fatal(err)
+	}
+	if err := table.close(); err == nil || !broken.closed {
+		t.Errorf("close %v, closed %v", err, broken.closed)
+	}
+}
+
+func TestBlockList(t *testing.T) {
+	want := []map[string]interface{}{
+		{"BlockId": uint64(1073741825), "GenerationStamp": uint64(1001), "NumBytes": uint64(10)},
+		{"BlockId": uint64(1073741826), "GenerationStamp": uint64(1002), "NumBytes": uint64(20)},
+	}
+	if got := blockList(fileRecord(16386, 10, 20)); !reflect.DeepEqual(got, want) {
+		t.Errorf("%v, want %v", got, want)
+	}
+	if got := blockList(fileRecord(16386)); got == nil || len(got) != 0 {
+		t.Errorf("no blocks: %#v, want an empty array", got)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lomik/hdfs-fsimage-dump/fsimage"
+	pb "github.com/lomik/hdfs-fsimage-dump/pb/hadoop_hdfs_fsimage"
+)
+
+// delimitedColumns are the columns of hdfs oiv -p Delimited
+var delimitedColumns = []string{
+	"Path", "Replication", "ModificationTime", "AccessTime", "PreferredBlockSize", "BlocksCount",
+	"FileSize", "NSQUOTA", "DSQUOTA", "Permission", "UserName", "GroupName",
+}
+
+// delimitedWriter writes records as lines of delimitedColumns
+type delimitedWriter struct {
+	delimiter string
+	escape    string
+}
+
+func newDelimitedWriter(delimiter string, escape string) (*delimitedWriter, error) {
+	if delimiter == "" {
+		return nil, fmt.Errorf("empty -delimiter")
+	}
+	switch escape {
+	case "oiv", "csv", "none":
+	default:
+		return nil, fmt.Errorf("unknown -escape %q", escape)
+	}
+	return &delimitedWriter{delimiter: delimiter, escape: escape}, nil
+}
+
+// header returns the line of column names
+func (d *delimitedWriter) header() string {
+	return strings.Join(delimitedColumns, d.delimiter) + "\n"
+}
+
+// field escapes a value:
+// oiv replaces line breaks with %x0D%x0A and %x0A and quotes values with the delimiter,
+// csv quotes values with the delimiter, quotes or line breaks like RFC 4180,
+// none writes values as is.
+func (d *delimitedWriter) field(s string) string {
+	switch d.escape {
+	case "oiv":
+		if strings.Contains(s, "\r\n") {
+			s = strings.Replace(s, "\r\n", "%x0D%x0A", -1)
+		} else if strings.Contains(s, "\n") {
+			s = strings.Replace(s, "\n", "%x0A", -1)
+		}
+		if strings.Contains(s, d.delimiter) {
+			s = `"` + strings.Replace(s, `"`, `""`, -1) + `"`
+		}
+	case "csv":
+		if strings.Contains(s, d.delimiter) || strings.ContainsAny(s, "\"\r\n") {
+			s = `"` + strings.Replace(s, `"`, `""`, -1) + `"`
+		}
+	}
+	return s
+}
+
+// write appends the line of a record to out
+func (d *delimitedWriter) write(out *bytes.Buffer, rec *fsimage.Record) {
+	var replication, blockSize, blocks, size uint64
+	var nsQuota, dsQuota int64
+	var atime uint64
+	var permission uint64
+
+	switch rec.Type {
+	case pb.INodeSection_INode_FILE:
+		replication = uint64(rec.Replication)
+		blockSize = rec.PreferredBlockSize
+		blocks = uint64(rec.BlocksCount)
+		size = rec.FileSize
+		atime = rec.AccessTime
+		permission = rec.INode.GetFile().GetPermission()
+	case pb.INodeSection_INode_DIRECTORY:
+		nsQuota = rec.NsQuota
+		dsQuota = rec.DsQuota
+		permission = rec.INode.GetDirectory().GetPermission()
+	case pb.INodeSection_INode_SYMLINK:
+		atime = rec.AccessTime
+		permission = rec.INode.GetSymlink().GetPermission()
+	}
+
+	out.WriteString(d.field(rec.Path))
+	for _, v := range []string{
+		strconv.FormatUint(replication, 10),
+		delimitedDate(rec.ModificationTime),
+		delimitedDate(atime),
+		strconv.FormatUint(blockSize, 10),
+		strconv.FormatUint(blocks, 10),
+		strconv.FormatUint(size, 10),
+		strconv.FormatInt(nsQuota, 10),
+		strconv.FormatInt(dsQuota, 10),
+		delimitedPermission(rec.Permission, permission),
+		rec.User,
+		rec.Group,
+	} {
+		out.WriteString(d.delimiter)
+		out.WriteString(d.field(v))
+	}
+	out.WriteByte('\n')
+}
+
+// delimitedDate formats milliseconds like oiv, in minutes
+func delimitedDate(ms uint64) string {
+	return time.Unix(0, int64(ms)*1e6).Format("2006-01-02 15:04")
+}
+
+// delimitedPermission formats a permission like FsPermission: without the ACL
+// "+" and with the sticky bit as t or T
+func delimitedPermission(s string, permission uint64) string {
+	s = strings.TrimSuffix(s, "+")
+	if permission&01000 == 0 {
+		return s
+	}
+	if strings.HasSuffix(s, "x") {
+		return s[:len(s)-1] + "t"
+	}
+	return s[:len(s)-1] + "T"
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/lomik/hdfs-fsimage-dump/fsimage"
+	pb "github.com/lomik/hdfs-fsimage-dump/pb/hadoop_hdfs_fsimage"
+)
+
+func TestDelimitedWriter(t *testing.T) {
+	local := time.Local
+	time.Local = time.UTC
+	defer func() { time.Local = local }()
+
+	records := []fsimage.Record{
+		{
+			Type: pb.INodeSection_INode_DIRECTORY, Path: "/", Permission: "drwxrwxrwx", User: "hdfs", Group: "supergroup",
+			ModificationTime: 1505725539089, NsQuota: 9223372036854775807, DsQuota: -1,
+			INode: &pb.INodeSection_INode{Directory: &pb.INodeSection_INodeDirectory{Permission: proto.Uint64(01777)}},
+		},
+		{
+			Type: pb.INodeSection_INode_FILE, Path: "/a b\nc", Permission: "-rw-r-----+", User: "alice", Group: "staff",
+			ModificationTime: 1505725539089, AccessTime: 1505405189045, Replication: 3, PreferredBlockSize: 134217728,
+			BlocksCount: 1, FileSize: 10382,
+			INode: &pb.INodeSection_INode{File: &pb.INodeSection_INodeFile{Permission: proto.Uint64(0640)}},
+		},
+		{
+			Type: pb.INodeSection_INode_SYMLINK, Path: "/l", Permission: "lrwxrwxrwx", User: "alice", Group: "staff",
+			ModificationTime: 1505725539089, AccessTime: 1505725539089,
+			INode: &pb.INodeSection_INode{Symlink: &pb.INodeSection_INodeSymlink{Permission: proto.Uint64(0777)}},
+		},
+	}
+
+	tests := []struct {
+		delimiter, escape string
+		want              string
+	}{
+		{"\t", "oiv", "" +
+			"/\t0\t2017-09-18 09:05\t1970-01-01 00:00\t0\t0\t0\t9223372036854775807\t-1\tdrwxrwxrwt\thdfs\tsupergroup\n" +
+			"/a b%x0Ac\t3\t2017-09-18 09:05\t2017-09-14 16:06\t134217728\t1\t10382\t0\t0\t-rw-r-----\talice\tstaff\n" +
+			"/l\t0\t2017-09-18 09:05\t2017-09-18 09:05\t0\t0\t0\t0\t0\tlrwxrwxrwx\talice\tstaff\n"},
+		{" ", "csv", "" +
+			"/ 0 \"2017-09-18 09:05\" \"1970-01-01 00:00\" 0 0 0 9223372036854775807 -1 drwxrwxrwt hdfs supergroup\n" +
+			"\"/a b\nc\" 3 \"2017-09-18 09:05\" \"2017-09-14 16:06\" 134217728 1 10382 0 0 -rw-r----- alice staff\n" +
+			"/l 0 \"2017-09-18 09:05\" \"2017-09-18 09:05\" 0 0 0 0 0 lrwxrwxrwx alice staff\n"},
+	}
+
+	for _, tt := range tests {
+		d, err := newDelimitedWriter(tt.delimiter, tt.escape)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		for i := range records {
+			d.write(&out, &records[i])
+		}
+		if out.String() != tt.want {
+			t.Errorf("%q %s:\n%s\nwant\n%s", tt.delimiter, tt.escape, out.String(), tt.want)
+		}
+	}
+
+	d, _ := newDelimitedWriter(",", "none")
+	if h := d.header(); h != "Path,Replication,ModificationTime,AccessTime,PreferredBlockSize,BlocksCount,FileSize,NSQUOTA,DSQUOTA,Permission,UserName,GroupName\n" {
+		t.Errorf("header %q", h)
+	}
+	for _, tt := range [][2]string{{"", "oiv"}, {"\t", "xml"}} {
+		if _, err := newDelimitedWriter(tt[0], tt[1]); err == nil {
+			t.Errorf("%q %s: no error", tt[0], tt[1])
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package fsimage
+
+import (
+	pb "github.com/lomik/hdfs-fsimage-dump/pb/hadoop_hdfs_fsimage"
+)
+
+// packing of AclFeatureProto entries, see FSImageFormatPBINode
+const (
+	aclPermMask   = 7
+	aclTypeOffset = 3
+	aclTypeMask   = 3
+	aclScopeBit   = 1 << 5
+	aclNameOffset = 6
+	aclNameMask   = 1<<24 - 1
+)
+
+var aclTypes = []string{"user", "group", "mask", "other"}
+
+const (
+	AclUser = iota
+	AclGroup
+	AclMask
+	AclOther
+)
+
+// AclEntry is one entry of an HDFS ACL.
+type AclEntry struct {
+	Default    bool
+	Type       int
+	Name       string
+	Permission uint32
+}
+
+// String formats the entry like getfacl: "default:user:alice:r-x".
+func (e AclEntry) String() string {
+	s := aclTypes[e.Type] + ":" + e.Name + ":" + permMap[e.Permission&aclPermMask]
+	if e.Default {
+		return "default:" + s
+	}
+	return s
+}
+
+// AclEntries returns the entries of the ACL feature as stored in the image,
+// without the owner, mask and other entries kept in the permission bits.
+func (ns *Namespace) AclEntries(acl *pb.INodeSection_AclFeatureProto) []AclEntry {
+	entries := make([]AclEntry, 0, len(acl.GetEntries()))
+	for _, v := range acl.GetEntries() {
+		entries = append(entries, AclEntry{
+			Default:    v&aclScopeBit != 0,
+			Type:       int(v>>aclTypeOffset) & aclTypeMask,
+			Name:       ns.Strings[(v>>aclNameOffset)&aclNameMask],
+			Permission: v & aclPermMask,
+		})
+	}
+	return entries
+}
+
+// Acl returns the ACL of an inode with the ACL feature as shown by getfacl,
+// nil without it. Like AclStorage.readINodeLogicalAcl, owner, mask and other
+// entries come from the permission bits, which keep the mask in group bits.
+func (ns *Namespace) Acl(permission uint64, acl *pb.INodeSection_AclFeatureProto) []AclEntry {
+	if acl == nil {
+		return nil
+	}
+	perm := uint32(permission % (1 << 16))
+
+	var access, defaults []AclEntry
+	for _, e := range ns.AclEntries(acl) {
+		if e.Default {
+			defaults = append(defaults, e)
+		} else {
+			access = append(access, e)
+		}
+	}
+
+	entries := make([]AclEntry, 0, len(access)+len(defaults)+3)
+	entries = append(entries, AclEntry{Type: AclUser, Permission: perm >> 6 & 7})
+	if len(access) > 0 {
+		entries = append(entries, access...)
+		entries = append(entries, AclEntry{Type: AclMask, Permission: perm >> 3 & 7})
+	} else {
+		entries = append(entries, AclEntry{Type: AclGroup, Permission: perm >> 3 & 7})
+	}
+	entries = append(entries, AclEntry{Type: AclOther, Permission: perm & 7})
+	return append(entries, defaults...)
+}
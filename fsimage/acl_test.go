@@ -0,0 +1,95 @@
+package fsimage
+
+import (
+	"strings"
+	"testing"
+
+	pb "github.com/lomik/hdfs-fsimage-dump/pb/hadoop_hdfs_fsimage"
+)
+
+// aclEntry packs an entry like FSImageFormatPBINode
+func aclEntry(def bool, typ int, name uint32, perm uint32) uint32 {
+	v := name<<aclNameOffset | uint32(typ)<<aclTypeOffset | perm
+	if def {
+		v |= aclScopeBit
+	}
+	return v
+}
+
+func TestAclEntries(t *testing.T) {
+	ns := &Namespace{Strings: map[uint32]string{7: "alice", aclNameMask: "last"}}
+
+	tests := []struct {
+		entry uint32
+		want  AclEntry
+		s     string
+	}{
+		{aclEntry(false, AclUser, 7, 5), AclEntry{Type: AclUser, Name: "alice", Permission: 5}, "user:alice:r-x"},
+		{aclEntry(false, AclGroup, 0, 6), AclEntry{Type: AclGroup, Permission: 6}, "group::rw-"},
+		{aclEntry(true, AclMask, 0, 7), AclEntry{Default: true, Type: AclMask, Permission: 7}, "default:mask::rwx"},
+		{aclEntry(true, AclOther, 0, 0), AclEntry{Default: true, Type: AclOther}, "default:other::---"},
+		{aclEntry(false, AclUser, aclNameMask, 1), AclEntry{Type: AclUser, Name: "last", Permission: 1}, "user:last:--x"},
+	}
+
+	for _, tt := range tests {
+		got := ns.AclEntries(&pb.INodeSection_AclFeatureProto{Entries: []uint32{tt.entry}})
+		if len(got) != 1 || got[0] != tt.want {
+			t.Errorf("%#x: %+v, want %+v", tt.entry, got, tt.want)
+			continue
+		}
+		if s := got[0].String(); s != tt.s {
+			t.Errorf("%#x: %q, want %q", tt.entry, s, tt.s)
+		}
+	}
+}
+
+func TestAcl(t *testing.T) {
+	ns := &Namespace{Strings: map[uint32]string{1: "alice", 2: "staff"}}
+
+	tests := []struct {
+		name       string
+		permission uint64
+		entries    []uint32
+		want       string
+	}{
+		{"no feature", 0750, nil, ""},
+		{"access entries, mask in group bits", 0750, []uint32{aclEntry(false, AclUser, 1, 7), aclEntry(false, AclGroup, 2, 5)},
+			"user::rwx,user:alice:rwx,group:staff:r-x,mask::r-x,other::---"},
+		{"default entries only", 1<<40 | 0751, []uint32{aclEntry(true, AclUser, 0, 7), aclEntry(true, AclMask, 0, 5)},
+			"user::rwx,group::r-x,other::--x,default:user::rwx,default:mask::r-x"},
+		{"access and default entries", 0700, []uint32{aclEntry(true, AclUser, 1, 4), aclEntry(false, AclGroup, 0, 4)},
+			"user::rwx,group::r--,mask::---,other::---,default:user:alice:r--"},
+	}
+
+	for _, tt := range tests {
+		var acl *pb.INodeSection_AclFeatureProto
+		if tt.entries != nil {
+			acl = &pb.INodeSection_AclFeatureProto{Entries: tt.entries}
+		}
+		var got []string
+		for _, e := range ns.Acl(tt.permission, acl) {
+			got = append(got, e.String())
+		}
+		if s := strings.Join(got, ","); s != tt.want {
+			t.Errorf("%s:\n%s\nwant\n%s", tt.name, s, tt.want)
+		}
+	}
+}
+
+func TestPermissionString(t *testing.T) {
+	tests := []struct {
+		typ        byte
+		permission uint64
+		want       string
+	}{
+		{'d', 1<<40 | 2<<16 | 0755, "drwxr-xr-x"},
+		{'-', 0640, "-rw-r-----"},
+		{'l', 01777, "lrwxrwxrwx"},
+		{'-', 0, "----------"},
+	}
+	for _, tt := range tests {
+		if got := PermissionString(tt.typ, tt.permission); got != tt.want {
+			t.Errorf("%c %o: %s, want %s", tt.typ, tt.permission, got, tt.want)
+		}
+	}
+}
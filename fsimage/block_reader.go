@@ -0,0 +1,120 @@
+package fsimage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+type Decompress func(src []byte, dst []byte) (n int, err error)
+
+// maxBlockSize limits the uncompressed and compressed size of one block
+const maxBlockSize = DefaultMaxFrameSize
+
+// BlockReader reads the block framing of Hadoop BlockCompressorStream: every
+// block is the uncompressed length followed by compressed chunks, each
+// prefixed by its length, until the block is complete.
+type BlockReader struct {
+	reader io.Reader
+	// uncompressed size of the current block and bytes decoded from it
+	limit   uint32
+	decoded uint32
+	buffer  []byte
+	// decoded bytes not read yet
+	buff  []byte
+	chunk []byte
+	// compressed bytes read
+	readed     int64
+	decompress Decompress
+}
+
+func NewBlockReader(r io.Reader, decompress Decompress) (io.Reader, error) {
+	var reader = new(BlockReader)
+	reader.reader = r
+	reader.decompress = decompress
+	return reader, nil
+}
+
+func (r *BlockReader) Read(b []byte) (n int, err error) {
+	if len(b) <= 0 {
+		return 0, nil
+	}
+	for len(r.buff) == 0 {
+		if err = r.readBlock(); err != nil {
+			return 0, err
+		}
+	}
+	n = copy(b, r.buff)
+	r.buff = r.buff[n:]
+	return n, nil
+}
+
+// readLength reads a big endian length. io.EOF means there are no more bytes.
+func (r *BlockReader) readLength() (uint32, error) {
+	var buf [4]byte
+	n, err := io.ReadFull(r.reader, buf[:])
+	r.readed += int64(n)
+	if err == io.ErrUnexpectedEOF {
+		return 0, fmt.Errorf("truncated block length at compressed offset %d", r.readed)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(buf[:]), nil
+}
+
+// readBlock decodes the next chunk into r.buff, starting a new block if needed
+func (r *BlockReader) readBlock() error {
+	// need handle a new big block
+	if r.limit == r.decoded {
+		limit, err := r.readLength()
+		if err != nil {
+			return err
+		}
+		if limit > maxBlockSize {
+			return fmt.Errorf("block of %d bytes at compressed offset %d is larger than %d", limit, r.readed, maxBlockSize)
+		}
+		r.limit = limit
+		r.decoded = 0
+		if uint32(cap(r.buffer)) < limit {
+			r.buffer = make([]byte, limit)
+		}
+		r.buffer = r.buffer[:limit]
+		if limit == 0 {
+			return nil
+		}
+	}
+
+	// chunk
+	offset := r.readed
+	length, err := r.readLength()
+	if err == io.EOF {
+		return fmt.Errorf("block ends after %d of %d bytes at compressed offset %d", r.decoded, r.limit, offset)
+	}
+	if err != nil {
+		return err
+	}
+	if length > maxBlockSize {
+		return fmt.Errorf("chunk of %d bytes at compressed offset %d is larger than %d", length, offset, maxBlockSize)
+	}
+	if uint32(cap(r.chunk)) < length {
+		r.chunk = make([]byte, length)
+	}
+	r.chunk = r.chunk[:length]
+	n, err := io.ReadFull(r.reader, r.chunk)
+	r.readed += int64(n)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("truncated chunk of %d bytes at compressed offset %d", length, offset)
+	}
+	if err != nil {
+		return err
+	}
+
+	deLen, err := r.decompress(r.chunk, r.buffer[r.decoded:])
+	if err != nil {
+		return fmt.Errorf("can't decompress chunk at compressed offset %d: %s", offset, err)
+	}
+	r.buff = r.buffer[r.decoded : r.decoded+uint32(deLen)]
+	r.decoded += uint32(deLen)
+	return nil
+}
@@ -0,0 +1,87 @@
+package fsimage
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/lomik/hdfs-fsimage-dump/lz4"
+	"github.com/lomik/hdfs-fsimage-dump/lzo"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+func snappy_decompress(src []byte, dst []byte) (n int, err error) {
+	n, err = snappy.DecodedLen(src)
+	if err != nil {
+		return 0, err
+	}
+	if n > len(dst) {
+		return 0, fmt.Errorf("snappy: %d decoded bytes do not fit into %d", n, len(dst))
+	}
+	decoded, err := snappy.Decode(dst[:n], src)
+	if err != nil {
+		return 0, err
+	}
+	return len(decoded), nil
+}
+
+func lzo_decompress(src []byte, dst []byte) (n int, err error) {
+	if len(src) == 0 || len(dst) == 0 {
+		return 0, fmt.Errorf("lzo: empty chunk")
+	}
+	n, err = lzo.LzoDecompress(src, dst)
+	return
+}
+
+func lz4_decompress(src []byte, dst []byte) (n int, err error) {
+	return lz4.Decompress(src, dst)
+}
+
+// zstdDecoder decodes chunks of ZStandardCodec block framing, it is created
+// on first use. It has a single decoder, so concurrent calls wait for each
+// other; BlockReader decodes the chunks of a section one by one anyway.
+var (
+	zstdOnce       sync.Once
+	zstdDecoder    *zstd.Decoder
+	zstdDecoderErr error
+)
+
+func zstd_decompress(src []byte, dst []byte) (n int, err error) {
+	zstdOnce.Do(func() {
+		zstdDecoder, zstdDecoderErr = zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+	})
+	if zstdDecoderErr != nil {
+		return 0, zstdDecoderErr
+	}
+	decoded, err := zstdDecoder.DecodeAll(src, dst[:0:len(dst)])
+	if err != nil {
+		return 0, err
+	}
+	if len(decoded) > len(dst) {
+		return 0, fmt.Errorf("zstd: %d decoded bytes do not fit into %d", len(decoded), len(dst))
+	}
+	return len(decoded), nil
+}
+
+// zstdMagic starts a zstd frame, skippable frames start with 0x184d2a5?
+var (
+	zstdMagic          = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	zstdSkippableMagic = []byte{0x2a, 0x4d, 0x18}
+)
+
+// newZstdReader reads a ZStandardCodec section. Hadoop ZStandardCodec is not
+// block framed: its compressor streams the section with ZSTD_compressStream
+// and the section is a plain sequence of zstd frames, so the section starts
+// with the frame magic and is read by one stream decoder. A section in block
+// framing starts with a block length instead and is read with BlockReader.
+func newZstdReader(section *bufio.Reader) (io.Reader, error) {
+	magic, err := section.Peek(len(zstdMagic))
+	if err == nil && !bytes.Equal(magic, zstdMagic) && !(magic[0]&0xf0 == 0x50 && bytes.Equal(magic[1:], zstdSkippableMagic)) {
+		return NewBlockReader(section, zstd_decompress)
+	}
+	return zstd.NewReader(section, zstd.WithDecoderConcurrency(1))
+}
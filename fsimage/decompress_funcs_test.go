@@ -0,0 +1,39 @@
+package fsimage
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestZstdReader(t *testing.T) {
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := enc.EncodeAll([]byte("hello "), nil)
+	second := enc.EncodeAll([]byte("world"), nil)
+	skippable := []byte{0x50, 0x2a, 0x4d, 0x18, 2, 0, 0, 0, 'x', 'y'}
+
+	tests := []struct {
+		name    string
+		section []byte
+	}{
+		{"frames", append(append([]byte(nil), first...), second...)},
+		{"skippable frame first", bytes.Join([][]byte{skippable, first, second}, nil)},
+		{"block framing", append(block(6, first), block(5, second)...)},
+	}
+
+	for _, tt := range tests {
+		r, err := newZstdReader(bufio.NewReader(bytes.NewReader(tt.section)))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		got, err := readAll(r)
+		if err != nil || string(got) != "hello world" {
+			t.Errorf("%s: read %q, %v", tt.name, got, err)
+		}
+	}
+}
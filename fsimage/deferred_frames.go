@@ -0,0 +1,167 @@
+package fsimage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// deferredMemory is the size of frames kept in memory before they go to a temp file
+const deferredMemory = 64 << 20
+
+// deferredFrames is a queue of inode frames waiting for the names of their ancestors.
+// Up to limit bytes of frames are kept in memory, the rest goes to a temp file in dir
+// (the default temp directory if dir is empty). Frames in memory are always older than
+// frames in the file.
+type deferredFrames struct {
+	dir   string
+	limit int
+
+	frames   [][]byte
+	head     int
+	memBytes int
+
+	file    *os.File
+	w       *bufio.Writer
+	r       *bufio.Reader
+	written int64
+	readOff int64
+	// count of frames in the file
+	count int
+	// cur is the front frame read from the file, nil if not read yet
+	cur []byte
+	buf []byte
+}
+
+// len returns the number of queued frames
+func (d *deferredFrames) len() int {
+	return len(d.frames) - d.head + d.count
+}
+
+func (d *deferredFrames) push(frame []byte) error {
+	if d.count == 0 && d.memBytes+len(frame) <= d.limit {
+		d.frames = append(d.frames, append([]byte(nil), frame...))
+		d.memBytes += len(frame)
+		return nil
+	}
+
+	if d.file == nil {
+		f, err := ioutil.TempFile(d.dir, "hdfs-fsimage-dump-")
+		if err != nil {
+			return err
+		}
+		os.Remove(f.Name())
+		d.file = f
+		d.w = bufio.NewWriter(fileAppender{d})
+		d.r = bufio.NewReader(fileTail{d})
+	}
+
+	var l [binary.MaxVarintLen64]byte
+	if _, err := d.w.Write(l[:binary.PutUvarint(l[:], uint64(len(frame)))]); err != nil {
+		return err
+	}
+	if _, err := d.w.Write(frame); err != nil {
+		return err
+	}
+	d.count++
+	return nil
+}
+
+// front returns the oldest frame without removing it or io.EOF if the queue is empty.
+// The frame is valid until the following call of front.
+func (d *deferredFrames) front() ([]byte, error) {
+	if d.head < len(d.frames) {
+		return d.frames[d.head], nil
+	}
+	if d.count == 0 {
+		return nil, io.EOF
+	}
+	if d.cur != nil {
+		return d.cur, nil
+	}
+
+	if d.w.Buffered() > 0 {
+		if err := d.w.Flush(); err != nil {
+			return nil, err
+		}
+	}
+	l, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(cap(d.buf)) < l {
+		d.buf = make([]byte, l)
+	}
+	d.buf = d.buf[:l]
+	if _, err = io.ReadFull(d.r, d.buf); err != nil {
+		return nil, err
+	}
+	d.cur = d.buf
+	return d.cur, nil
+}
+
+// pop removes the frame returned by front
+func (d *deferredFrames) pop() error {
+	if d.head < len(d.frames) {
+		d.memBytes -= len(d.frames[d.head])
+		d.frames[d.head] = nil
+		d.head++
+		if d.head == len(d.frames) {
+			d.frames = d.frames[:0]
+			d.head = 0
+		}
+		return nil
+	}
+
+	d.cur = nil
+	d.count--
+	if d.count > 0 {
+		return nil
+	}
+	// the file is drained, start it over
+	d.written = 0
+	d.readOff = 0
+	d.r.Reset(fileTail{d})
+	return d.file.Truncate(0)
+}
+
+func (d *deferredFrames) close() {
+	if d.file != nil {
+		d.file.Close()
+		d.file = nil
+	}
+	d.frames = nil
+}
+
+// fileAppender writes at the end of the queue file
+type fileAppender struct {
+	d *deferredFrames
+}
+
+func (a fileAppender) Write(p []byte) (int, error) {
+	n, err := a.d.file.WriteAt(p, a.d.written)
+	a.d.written += int64(n)
+	return n, err
+}
+
+// fileTail reads the queue file from the oldest unread byte
+type fileTail struct {
+	d *deferredFrames
+}
+
+func (t fileTail) Read(p []byte) (int, error) {
+	if t.d.readOff >= t.d.written {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > t.d.written-t.d.readOff {
+		p = p[:t.d.written-t.d.readOff]
+	}
+	n, err := t.d.file.ReadAt(p, t.d.readOff)
+	t.d.readOff += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
@@ -0,0 +1,121 @@
+package fsimage
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestDeferredFramesOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deferred")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name  string
+		limit int
+		dir   string
+	}{
+		{"memory", 1 << 20, ""},
+		{"file", 0, dir},
+		{"memory then file", 40, dir},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &deferredFrames{dir: tt.dir, limit: tt.limit}
+			defer d.close()
+
+			pushed, popped := 0, 0
+			pop := func() {
+				frame, err := d.front()
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := []byte(fmt.Sprintf("frame %d", popped))
+				if !bytes.Equal(frame, want) {
+					t.Fatalf("front = %q, want %q", frame, want)
+				}
+				if err = d.pop(); err != nil {
+					t.Fatal(err)
+				}
+				popped++
+			}
+
+			// pushes and pops interleave, the queue is drained several times
+			for round := 0; round < 5; round++ {
+				for i := 0; i < 3+round*4; i++ {
+					if err := d.push([]byte(fmt.Sprintf("frame %d", pushed))); err != nil {
+						t.Fatal(err)
+					}
+					pushed++
+					if i%3 == 2 {
+						pop()
+					}
+				}
+				for d.len() > round {
+					pop()
+				}
+			}
+			for d.len() > 0 {
+				pop()
+			}
+
+			if _, err := d.front(); err != io.EOF {
+				t.Fatalf("front of empty queue = %v, want io.EOF", err)
+			}
+			if popped != pushed {
+				t.Fatalf("popped %d of %d frames", popped, pushed)
+			}
+		})
+	}
+}
+
+func TestINodePassSpill(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	b, _ := newShuffledTree(t)
+	img := b.open(t)
+
+	// frames are held back in memory without a spill dir and in a file with one
+	for _, spillDir := range []string{"", dir} {
+		ns, err := img.LoadNamespaceWith(NamespaceOptions{SpillDir: spillDir})
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err := img.newINodePass(ns, false, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		held, file := false, false
+		for {
+			_, _, err := p.next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			held = held || p.deferred.len() > 0
+			file = file || p.deferred.file != nil
+		}
+		p.close()
+		ns.Close()
+
+		if !held {
+			t.Fatalf("spill dir %q: no inode was held back", spillDir)
+		}
+		if file != (spillDir != "") {
+			t.Errorf("spill dir %q: temp file created %v", spillDir, file)
+		}
+	}
+}
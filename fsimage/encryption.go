@@ -0,0 +1,139 @@
+package fsimage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+
+	pbh "github.com/lomik/hdfs-fsimage-dump/pb/hadoop_hdfs"
+	pb "github.com/lomik/hdfs-fsimage-dump/pb/hadoop_hdfs_fsimage"
+)
+
+// names of the raw xattrs of encryption zones and encrypted files
+const (
+	zoneXAttrName     = "hdfs.crypto.encryption.zone"
+	fileInfoXAttrName = "hdfs.crypto.file.encryption.info"
+	xattrRawNamespace = 4
+)
+
+// maxZoneDepth stops the search of a zone in a broken tree with a cycle
+const maxZoneDepth = 4096
+
+// EncryptionZone is a directory with the raw.hdfs.crypto.encryption.zone xattr.
+type EncryptionZone struct {
+	Id                    uint64
+	Path                  string
+	KeyName               string
+	Suite                 string
+	CryptoProtocolVersion string
+}
+
+// Zones returns the encryption zones found so far sorted by path. All zones
+// are known after the INODE section is read.
+func (ns *Namespace) Zones() []*EncryptionZone {
+	zones := make([]*EncryptionZone, 0, len(ns.zones))
+	for _, z := range ns.zones {
+		ns.setZonePath(z)
+		zones = append(zones, z)
+	}
+	sort.Slice(zones, func(i, j int) bool {
+		return zones[i].Path < zones[j].Path
+	})
+	return zones
+}
+
+// zoneXAttr returns the encoded XAttrCompactProto of the zone xattr as it
+// appears in an inode frame, nil if the string table has no such name
+func (ns *Namespace) zoneXAttr() []byte {
+	for id, s := range ns.Strings {
+		if s == zoneXAttrName {
+			v := id<<xattrNameOffset | (xattrRawNamespace>>2)<<xattrNamespaceExtOffset | (xattrRawNamespace&xattrNamespaceMask)<<xattrNamespaceOffset
+			// tag of field 1 with fixed32 wire type
+			pattern := []byte{0x0d, 0, 0, 0, 0}
+			binary.LittleEndian.PutUint32(pattern[1:], v)
+			return pattern
+		}
+	}
+	return nil
+}
+
+// addZone registers a directory as an encryption zone if its frame has the
+// zone xattr. pattern from zoneXAttr filters frames without decoding them.
+func (ns *Namespace) addZone(frame []byte, pattern []byte) error {
+	if pattern == nil || !bytes.Contains(frame, pattern) {
+		return nil
+	}
+	inode := &pb.INodeSection_INode{}
+	if err := proto.Unmarshal(frame, inode); err != nil {
+		return decodeError(frame, err)
+	}
+	for _, x := range ns.XAttrs(inode.GetDirectory().GetXAttrs()) {
+		if x.Namespace != xattrRawNamespace || x.Name != zoneXAttrName {
+			continue
+		}
+		info := &pbh.ZoneEncryptionInfoProto{}
+		if err := proto.Unmarshal(x.Value, info); err != nil {
+			return &NodeError{Id: inode.GetId(), Name: string(inode.GetName()), Err: err}
+		}
+		ns.zones[inode.GetId()] = &EncryptionZone{
+			Id:                    inode.GetId(),
+			KeyName:               info.GetKeyName(),
+			Suite:                 info.GetSuite().String(),
+			CryptoProtocolVersion: info.GetCryptoProtocolVersion().String(),
+		}
+	}
+	return nil
+}
+
+// zoneOf returns the encryption zone of inode key or nil. Renames across zones
+// are not allowed, so the zone is the same for all paths of an inode.
+func (ns *Namespace) zoneOf(key uint64) *EncryptionZone {
+	if len(ns.zones) == 0 {
+		return nil
+	}
+	for i := 0; i < maxZoneDepth && key != 0; i++ {
+		if z, ok := ns.zones[key]; ok {
+			ns.setZonePath(z)
+			return z
+		}
+		if key == RootInodeID {
+			return nil
+		}
+		node, _, found := ns.Tree.pathNode(key, 0)
+		if !found {
+			return nil
+		}
+		key = node.Parent
+	}
+	return nil
+}
+
+// setZonePath fills the current path of a zone once its ancestors are named
+func (ns *Namespace) setZonePath(z *EncryptionZone) {
+	if z.Path != "" {
+		return
+	}
+	if z.Id == RootInodeID {
+		z.Path = "/"
+		return
+	}
+	z.Path, _ = getPathsReq(z.Id, 0, ns.Tree, false)
+}
+
+// KeyVersionName returns the ezKeyVersionName of a file with the
+// raw.hdfs.crypto.file.encryption.info xattr, "" otherwise.
+func KeyVersionName(xattrs []XAttr) string {
+	for _, x := range xattrs {
+		if x.Namespace != xattrRawNamespace || x.Name != fileInfoXAttrName {
+			continue
+		}
+		info := &pbh.PerFileEncryptionInfoProto{}
+		if err := proto.Unmarshal(x.Value, info); err != nil {
+			return ""
+		}
+		return info.GetEzKeyVersionName()
+	}
+	return ""
+}
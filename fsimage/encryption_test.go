@@ -0,0 +1,177 @@
+package fsimage
+
+import (
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	pbh "github.com/lomik/hdfs-fsimage-dump/pb/hadoop_hdfs"
+	pb "github.com/lomik/hdfs-fsimage-dump/pb/hadoop_hdfs_fsimage"
+)
+
+// ids of the string table of newZoneImage
+const (
+	testZoneName     = 3
+	testFileInfoName = 4
+	testTagName      = 5
+)
+
+// zoneXAttrs returns the xattrs of an encryption zone with key
+func zoneXAttrs(t testing.TB, key string) *pb.INodeSection_XAttrFeatureProto {
+	value, err := proto.Marshal(&pbh.ZoneEncryptionInfoProto{
+		Suite:                 pbh.CipherSuiteProto_AES_CTR_NOPADDING.Enum(),
+		CryptoProtocolVersion: pbh.CryptoProtocolVersionProto_ENCRYPTION_ZONES.Enum(),
+		KeyName:               proto.String(key),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &pb.INodeSection_XAttrFeatureProto{XAttrs: []*pb.INodeSection_XAttrCompactProto{
+		{Name: proto.Uint32(xattrName(0, testTagName)), Value: []byte("v")},
+		{Name: proto.Uint32(xattrName(xattrRawNamespace, testZoneName)), Value: value},
+	}}
+}
+
+// fileInfoXAttr returns the xattr of a file encrypted with keyVersion
+func fileInfoXAttr(t testing.TB, keyVersion string) *pb.INodeSection_XAttrCompactProto {
+	value, err := proto.Marshal(&pbh.PerFileEncryptionInfoProto{
+		Key:              []byte{1, 2, 3},
+		Iv:               []byte{4, 5, 6},
+		EzKeyVersionName: proto.String(keyVersion),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &pb.INodeSection_XAttrCompactProto{Name: proto.Uint32(xattrName(xattrRawNamespace, testFileInfoName)), Value: value}
+}
+
+// newZoneImage returns an image with the zone /secure of key k1, the nested
+// zone /secure/inner of key k2 and the directory /plain. Files come before
+// their zones in the INODE section.
+func newZoneImage(t testing.TB) *testImage {
+	secure := testDir(16386, "secure")
+	secure.Directory.XAttrs = zoneXAttrs(t, "k1")
+	inner := testDir(16388, "inner")
+	inner.Directory.XAttrs = zoneXAttrs(t, "k2")
+	// the zone xattr name in the user namespace does not make a zone
+	plain := testDir(16390, "plain")
+	plain.Directory.XAttrs = &pb.INodeSection_XAttrFeatureProto{XAttrs: []*pb.INodeSection_XAttrCompactProto{
+		{Name: proto.Uint32(xattrName(0, testZoneName)), Value: []byte("v")},
+	}}
+
+	f := testFile(16387, "f", 10)
+	f.File.XAttrs = &pb.INodeSection_XAttrFeatureProto{XAttrs: []*pb.INodeSection_XAttrCompactProto{fileInfoXAttr(t, "k1@0")}}
+	g := testFile(16389, "g", 20)
+	g.File.XAttrs = &pb.INodeSection_XAttrFeatureProto{XAttrs: []*pb.INodeSection_XAttrCompactProto{fileInfoXAttr(t, "k2@3")}}
+
+	b := newTestImage()
+	b.add(t, "STRING_TABLE", &pb.StringTableSection{NumEntry: proto.Uint32(5)},
+		&pb.StringTableSection_Entry{Id: proto.Uint32(1), Str: proto.String("hdfs")},
+		&pb.StringTableSection_Entry{Id: proto.Uint32(2), Str: proto.String("supergroup")},
+		&pb.StringTableSection_Entry{Id: proto.Uint32(testZoneName), Str: proto.String(zoneXAttrName)},
+		&pb.StringTableSection_Entry{Id: proto.Uint32(testFileInfoName), Str: proto.String(fileInfoXAttrName)},
+		&pb.StringTableSection_Entry{Id: proto.Uint32(testTagName), Str: proto.String("tag")})
+	b.addTree(t, []*pb.INodeSection_INode{testDir(RootInodeID, ""), f, g, secure, inner, plain, testFile(16391, "h", 30)},
+		map[uint64][]uint64{RootInodeID: {16386, 16390}, 16386: {16387, 16388}, 16388: {16389}, 16390: {16391}})
+	return b
+}
+
+func TestEncryptionZones(t *testing.T) {
+	img := newZoneImage(t).open(t)
+	ns, err := img.LoadNamespace(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := img.NewRecordReader(ns, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type zoneFields struct{ zone, key, keyVersion string }
+	got := make(map[string]zoneFields)
+	for {
+		rec, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[rec.Path] = zoneFields{rec.EncryptionZone, rec.KeyName, rec.KeyVersionName}
+	}
+	wantRecords := map[string]zoneFields{
+		"/secure":         {"/secure", "k1", ""},
+		"/secure/f":       {"/secure", "k1", "k1@0"},
+		"/secure/inner":   {"/secure/inner", "k2", ""},
+		"/secure/inner/g": {"/secure/inner", "k2", "k2@3"},
+		"/plain":          {"", "", ""},
+		"/plain/h":        {"", "", ""},
+	}
+	if !reflect.DeepEqual(got, wantRecords) {
+		t.Errorf("records %+v, want %+v", got, wantRecords)
+	}
+
+	zones := ns.Zones()
+	want := []*EncryptionZone{
+		{Id: 16386, Path: "/secure", KeyName: "k1", Suite: "AES_CTR_NOPADDING", CryptoProtocolVersion: "ENCRYPTION_ZONES"},
+		{Id: 16388, Path: "/secure/inner", KeyName: "k2", Suite: "AES_CTR_NOPADDING", CryptoProtocolVersion: "ENCRYPTION_ZONES"},
+	}
+	if len(zones) != len(want) {
+		t.Fatalf("%d zones, want %d", len(zones), len(want))
+	}
+	for i := range want {
+		if *zones[i] != *want[i] {
+			t.Errorf("zone %+v, want %+v", *zones[i], *want[i])
+		}
+	}
+}
+
+func TestEncryptionZoneBroken(t *testing.T) {
+	dir := testDir(16386, "secure")
+	dir.Directory.XAttrs = &pb.INodeSection_XAttrFeatureProto{XAttrs: []*pb.INodeSection_XAttrCompactProto{
+		{Name: proto.Uint32(xattrName(xattrRawNamespace, testZoneName)), Value: []byte{0x0a, 5}},
+	}}
+	b := newTestImage()
+	b.add(t, "STRING_TABLE", &pb.StringTableSection{NumEntry: proto.Uint32(3)},
+		&pb.StringTableSection_Entry{Id: proto.Uint32(1), Str: proto.String("hdfs")},
+		&pb.StringTableSection_Entry{Id: proto.Uint32(2), Str: proto.String("supergroup")},
+		&pb.StringTableSection_Entry{Id: proto.Uint32(testZoneName), Str: proto.String(zoneXAttrName)})
+	b.addTree(t, []*pb.INodeSection_INode{testDir(RootInodeID, ""), dir}, map[uint64][]uint64{RootInodeID: {16386}})
+
+	img := b.open(t)
+	ns, err := img.LoadNamespace(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := img.NewRecordReader(ns, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for err == nil {
+		_, err = r.Next()
+	}
+	if e, ok := err.(*NodeError); !ok || e.Id != 16386 || e.Name != "secure" {
+		t.Errorf("error %v, want NodeError of 16386", err)
+	}
+}
+
+func TestKeyVersionName(t *testing.T) {
+	info := fileInfoXAttr(t, "k1@7")
+	tests := []struct {
+		name   string
+		xattrs []XAttr
+		want   string
+	}{
+		{"no xattrs", nil, ""},
+		{"file info", []XAttr{{Namespace: 0, Name: "tag"}, {Namespace: xattrRawNamespace, Name: fileInfoXAttrName, Value: info.Value}}, "k1@7"},
+		{"user namespace", []XAttr{{Namespace: 0, Name: fileInfoXAttrName, Value: info.Value}}, ""},
+		{"broken value", []XAttr{{Namespace: xattrRawNamespace, Name: fileInfoXAttrName, Value: []byte{0x0a, 5}}}, ""},
+	}
+
+	for _, tt := range tests {
+		if got := KeyVersionName(tt.xattrs); got != tt.want {
+			t.Errorf("%s: %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package fsimage
+
+import "fmt"
+
+var ErrorUnknownInode = fmt.Errorf("unknown inode")
+var ErrorEmptyName = fmt.Errorf("empty name")
+var ErrorUnknownCodec = fmt.Errorf("unknown compression codec")
+
+// errorPending is returned by strict resolution if a name on the way is not known yet
+var errorPending = fmt.Errorf("name is not known yet")
+
+// UnknownCodecError names the codec of the FileSummary that can't be decompressed
+type UnknownCodecError struct {
+	Codec string
+}
+
+func (e *UnknownCodecError) Error() string {
+	return fmt.Sprintf("%s %q", ErrorUnknownCodec, e.Codec)
+}
+
+func (e *UnknownCodecError) Unwrap() error {
+	return ErrorUnknownCodec
+}
+
+// NodeError is an inconsistency of one inode met while building the tree or
+// resolving paths.
+type NodeError struct {
+	Section string
+	Id      uint64
+	SnapId  uint32
+	Name    string
+	Err     error
+}
+
+func (e *NodeError) Error() string {
+	if e.Name != "" {
+		return fmt.Sprintf("%s: inode %d (%s), snapshot %d: %s", e.Section, e.Id, e.Name, e.SnapId, e.Err)
+	}
+	return fmt.Sprintf("%s: inode %d, snapshot %d: %s", e.Section, e.Id, e.SnapId, e.Err)
+}
+
+func (e *NodeError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorHandler is called for every NodeError. If it returns nil the inode is
+// skipped and processing goes on, otherwise processing stops with the returned
+// error. It may be called concurrently from several workers.
+type ErrorHandler func(err *NodeError) error
+
+// handleNodeError sets the section of a NodeError and passes it to onError.
+// Other errors and all errors without onError are returned as is.
+func handleNodeError(err error, section string, onError ErrorHandler) error {
+	e, ok := err.(*NodeError)
+	if !ok {
+		return err
+	}
+	if e.Section == "" {
+		e.Section = section
+	}
+	if onError == nil {
+		return e
+	}
+	return onError(e)
+}
+
+// decodeError wraps an error of decoding an inode frame into a NodeError
+func decodeError(frame []byte, err error) error {
+	_, id, name, _ := parseINodeHeader(frame)
+	return &NodeError{Id: id, Name: string(name), Err: err}
+}
@@ -0,0 +1,157 @@
+package fsimage
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"sort"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/lomik/hdfs-fsimage-dump/pb/hadoop_hdfs_fsimage"
+)
+
+func TestParseINodeHeader(t *testing.T) {
+	full, err := proto.Marshal(testFile(RootInodeID+1, "a.txt", 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		frame []byte
+		typ   pb.INodeSection_INode_Type
+		id    uint64
+		iname string
+		err   bool
+	}{
+		{"inode", full, pb.INodeSection_INode_FILE, RootInodeID + 1, "a.txt", false},
+		{"empty", nil, 0, 0, "", false},
+		{"fixed64 and fixed32 fields", []byte{1<<3 | 0, 2, 9<<3 | 1, 1, 2, 3, 4, 5, 6, 7, 8, 10<<3 | 5, 1, 2, 3, 4, 2<<3 | 0, 7},
+			pb.INodeSection_INode_DIRECTORY, 7, "", false},
+		{"truncated varint", []byte{2<<3 | 0, 0x80}, 0, 0, "", true},
+		{"truncated tag", []byte{0x80}, 0, 0, "", true},
+		{"name longer than frame", []byte{3<<3 | 2, 5, 'a'}, 0, 0, "", true},
+		{"truncated fixed64", []byte{9<<3 | 1, 1, 2}, 0, 0, "", true},
+		{"group wire type", []byte{9<<3 | 3}, 0, 0, "", true},
+		{"truncated inode", full[:len(full)-3], 0, 0, "", true},
+	}
+
+	for _, tt := range tests {
+		typ, id, name, err := parseINodeHeader(tt.frame)
+		if (err != nil) != tt.err {
+			t.Errorf("%s: error %v", tt.name, err)
+			continue
+		}
+		if err != nil {
+			if !errors.Is(err, ErrorBrokenSection) {
+				t.Errorf("%s: error %v is not ErrorBrokenSection", tt.name, err)
+			}
+			continue
+		}
+		if typ != tt.typ || id != tt.id || string(name) != tt.iname {
+			t.Errorf("%s: got %v %d %q", tt.name, typ, id, name)
+		}
+	}
+}
+
+func TestHandleNodeError(t *testing.T) {
+	other := errors.New("other")
+	var seen []*NodeError
+	skip := func(e *NodeError) error {
+		seen = append(seen, e)
+		return nil
+	}
+
+	if err := handleNodeError(other, "INODE", skip); err != other {
+		t.Errorf("other error = %v", err)
+	}
+	if len(seen) != 0 {
+		t.Error("handler got an error which is not a NodeError")
+	}
+
+	err := handleNodeError(&NodeError{Id: 1, Err: ErrorEmptyName}, "INODE", nil)
+	var e *NodeError
+	if !errors.As(err, &e) || e.Section != "INODE" || !errors.Is(err, ErrorEmptyName) {
+		t.Errorf("error without handler = %v", err)
+	}
+
+	if err = handleNodeError(&NodeError{Section: "SNAPSHOT_DIFF", Id: 2, Err: ErrorUnknownInode}, "INODE", skip); err != nil {
+		t.Errorf("skipped error = %v", err)
+	}
+	if len(seen) != 1 || seen[0].Section != "SNAPSHOT_DIFF" {
+		t.Errorf("handler got %v", seen)
+	}
+}
+
+// newBrokenImage returns an image with a file without a name, a directory that is
+// not in INODE_DIR and a file that can't be decoded next to good inodes
+func newBrokenImage(t *testing.T) *Image {
+	b := newTestImage()
+	inodes := []*pb.INodeSection_INode{
+		testDir(RootInodeID, ""),
+		testFile(RootInodeID+1, "good", 1),
+		testFile(RootInodeID+2, ""),
+		testDir(RootInodeID+3, "unlinked"),
+		testFile(RootInodeID+5, "good too", 2),
+	}
+	b.addTree(t, inodes, map[uint64][]uint64{RootInodeID: {RootInodeID + 1, RootInodeID + 2, RootInodeID + 4, RootInodeID + 5}})
+
+	// inode 4 has a file feature which is not a message
+	b.addRaw("INODE", []byte{1<<3 | 0, 1, 2<<3 | 0, 0x85, 0x80, 1, 3<<3 | 2, 1, 'x', 4<<3 | 2, 2, 0xff, 0xff})
+	return b.open(t)
+}
+
+func TestOnError(t *testing.T) {
+	img := newBrokenImage(t)
+
+	ns, err := img.LoadNamespace(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = img.ProcessRecords(ns, ParallelOptions{}, func([]Record, *bytes.Buffer) error { return nil }, ioutil.Discard); err == nil {
+		t.Error("no error without a handler")
+	}
+
+	var skipped []*NodeError
+	ns, err = img.LoadNamespaceWith(NamespaceOptions{OnError: func(e *NodeError) error {
+		skipped = append(skipped, e)
+		return nil
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	err = img.ProcessRecords(ns, ParallelOptions{Workers: 1}, func(records []Record, out *bytes.Buffer) error {
+		for _, rec := range records {
+			out.WriteString(rec.Path + "\n")
+		}
+		return nil
+	}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "/good\n/good too\n" {
+		t.Errorf("records:\n%s", out.String())
+	}
+
+	sort.Slice(skipped, func(i, j int) bool { return skipped[i].Id < skipped[j].Id })
+	want := []struct {
+		id  uint64
+		err error
+	}{
+		{RootInodeID + 2, ErrorEmptyName},
+		{RootInodeID + 3, ErrorUnknownInode},
+		{RootInodeID + 4, nil},
+	}
+	if len(skipped) != len(want) {
+		t.Fatalf("skipped %v", skipped)
+	}
+	for i, w := range want {
+		e := skipped[i]
+		if e.Id != w.id || e.Section != "INODE" || (w.err != nil && !errors.Is(e, w.err)) {
+			t.Errorf("skipped %d: %v", i, e)
+		}
+	}
+}
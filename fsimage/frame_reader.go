@@ -0,0 +1,163 @@
+package fsimage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"github.com/golang/protobuf/proto"
+	"io"
+)
+
+// DefaultMaxFrameSize is the default limit of one frame. Frame buffers start
+// small and grow up to this size.
+const DefaultMaxFrameSize = 256 << 20
+
+const minFrameBuffer = 64 << 10
+
+type FrameReader struct {
+	reader io.Reader
+	buffer []byte
+	length int64
+	readed int64
+	name   string
+	// MaxFrameSize limits the length of one frame, DefaultMaxFrameSize if 0
+	MaxFrameSize int64
+}
+
+func NewFrameReader(imageFile io.ReaderAt, offset int64, length int64) (*FrameReader, error) {
+	return &FrameReader{
+		reader: bufio.NewReader(io.NewSectionReader(imageFile, offset, length)),
+		length: length,
+	}, nil
+}
+
+var ErrorBrokenSection = fmt.Errorf("section is broken")
+
+// BrokenSectionError is ErrorBrokenSection with the position of the broken
+// frame. Offset is counted in decompressed bytes from the section start.
+type BrokenSectionError struct {
+	Section string
+	Offset  int64
+	Reason  string
+}
+
+func (e *BrokenSectionError) Error() string {
+	if e.Section != "" {
+		return fmt.Sprintf("section %s is broken at offset %d: %s", e.Section, e.Offset, e.Reason)
+	}
+	return fmt.Sprintf("section is broken at offset %d: %s", e.Offset, e.Reason)
+}
+
+func (e *BrokenSectionError) Unwrap() error {
+	return ErrorBrokenSection
+}
+
+func brokenSection(section string, offset int64, format string, args ...interface{}) error {
+	return &BrokenSectionError{
+		Section: section,
+		Offset:  offset,
+		Reason:  fmt.Sprintf(format, args...),
+	}
+}
+
+// frameBuffer returns buf resized to n bytes, growing it if needed
+func frameBuffer(buf []byte, n int, max int64) []byte {
+	if n <= cap(buf) {
+		return buf[:n]
+	}
+	size := 2 * cap(buf)
+	if size < minFrameBuffer {
+		size = minFrameBuffer
+	}
+	if int64(size) > max {
+		size = int(max)
+	}
+	if size < n {
+		size = n
+	}
+	return make([]byte, n, size)
+}
+
+func maxFrameSize(max int64) int64 {
+	if max <= 0 {
+		return DefaultMaxFrameSize
+	}
+	return max
+}
+
+// readUvarint reads a varint byte by byte from r. It returns io.EOF only if
+// there are no more bytes at all.
+func readUvarint(r io.Reader, readed *int64, section string) (uint64, error) {
+	offset := *readed
+
+	var buf [binary.MaxVarintLen64]byte
+
+	// varint max length is 10 bytes
+	for i := 0; i < len(buf); i++ {
+		n, err := io.ReadFull(r, buf[i:i+1])
+		*readed += int64(n)
+		if err == io.EOF && i > 0 {
+			return 0, brokenSection(section, offset, "truncated varint")
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		if buf[i]&0x80 == 0 {
+			v, n := binary.Uvarint(buf[:i+1])
+			if n <= 0 {
+				return 0, brokenSection(section, offset, "bad varint")
+			}
+			return v, nil
+		}
+	}
+
+	return 0, brokenSection(section, offset, "varint is longer than %d bytes", len(buf))
+}
+
+func (r *FrameReader) ReadUvarint() (uint64, error) {
+	if r.readed >= r.length {
+		return 0, io.EOF
+	}
+	return readUvarint(r.reader, &r.readed, r.name)
+}
+
+func (r *FrameReader) ReadFrame() ([]byte, error) {
+	offset := r.readed
+
+	length, err := r.ReadUvarint()
+	if err != nil {
+		return nil, err
+	}
+
+	max := maxFrameSize(r.MaxFrameSize)
+	if length > uint64(max) {
+		return nil, brokenSection(r.name, offset, "frame of %d bytes is larger than max frame size %d", length, max)
+	}
+	if r.readed+int64(length) > r.length {
+		return nil, brokenSection(r.name, offset, "frame of %d bytes ends after the section end %d", length, r.length)
+	}
+
+	r.buffer = frameBuffer(r.buffer, int(length), max)
+	n, err := io.ReadFull(r.reader, r.buffer)
+	r.readed += int64(n)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, brokenSection(r.name, offset, "truncated frame of %d bytes", length)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return r.buffer, nil
+}
+
+func (r *FrameReader) ReadMessage(msg proto.Message) error {
+	body, err := r.ReadFrame()
+	if err != nil {
+		return err
+	}
+	if err = proto.Unmarshal(body, msg); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package fsimage
+
+import (
+	"bufio"
+	"compress/bzip2"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/lomik/hdfs-fsimage-dump/lz4"
+	"github.com/lomik/hdfs-fsimage-dump/lzo"
+)
+
+type FrameReader2 struct {
+	reader  io.Reader
+	section *bufio.Reader
+	counter *countingReader
+	buffer  []byte
+	// length of the compressed section
+	length int64
+	// decompressed bytes read
+	readed int64
+	name   string
+	// MaxFrameSize limits the length of one frame, DefaultMaxFrameSize if 0
+	MaxFrameSize int64
+}
+
+// countingReader counts bytes read from the compressed section
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// NewFrameReader2 returns a reader of a section compressed with codec. Block
+// framed codecs are decompressed on up to workers goroutines.
+func NewFrameReader2(imageFile io.ReaderAt, offset int64, length int64, codec string, workers int) (*FrameReader2, error) {
+	var reader io.Reader
+	var err error
+
+	counter := &countingReader{r: io.NewSectionReader(imageFile, offset, length)}
+	section := bufio.NewReader(counter)
+
+	if codec == "org.apache.hadoop.io.compress.DefaultCodec" {
+		reader, err = zlib.NewReader(section)
+		if err != nil {
+			return nil, err
+		}
+	} else if codec == "org.apache.hadoop.io.compress.SnappyCodec" {
+		reader, err = newBlockReader(section, snappy_decompress, snappy.DecodedLen, workers)
+		if err != nil {
+			return nil, err
+		}
+	} else if codec == "org.apache.hadoop.io.compress.GzipCodec" {
+		reader, err = gzip.NewReader(section)
+		if err != nil {
+			return nil, err
+		}
+	} else if codec == "org.apache.hadoop.io.compress.BZip2Codec" {
+		reader = bzip2.NewReader(section)
+	} else if codec == "com.hadoop.compression.lzo.LzoCodec" {
+		reader, err = newBlockReader(section, lzo_decompress, lzo.DecodedLen1X, workers)
+		if err != nil {
+			return nil, err
+		}
+	} else if codec == "com.hadoop.compression.lzo.LzopCodec" {
+		reader, err = lzo.NewReader(section)
+		if err != nil {
+			return nil, err
+		}
+	} else if codec == "org.apache.hadoop.io.compress.Lz4Codec" {
+		reader, err = newBlockReader(section, lz4_decompress, lz4.DecodedLen, workers)
+		if err != nil {
+			return nil, err
+		}
+	} else if codec == "org.apache.hadoop.io.compress.ZStandardCodec" {
+		reader, err = newZstdReader(section)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, &UnknownCodecError{Codec: codec}
+	}
+
+	return &FrameReader2{
+		reader:  reader,
+		section: section,
+		counter: counter,
+		length:  length,
+	}, nil
+}
+
+// newBlockReader decompresses blocks in parallel if decodedLen is set. Every
+// chunk starts with its compressed length, but only the decoded lengths tell
+// whether a block has more chunks: Snappy chunks store it in their header,
+// DecodedLen1X and lz4.DecodedLen count it by parsing LZO and LZ4 chunks
+// without writing the output.
+func newBlockReader(r io.Reader, decompress Decompress, decodedLen DecodedLen, workers int) (io.Reader, error) {
+	if decodedLen == nil || workers <= 1 {
+		return NewBlockReader(r, decompress)
+	}
+	return NewParallelBlockReader(r, decompress, decodedLen, workers)
+}
+
+// consumed returns the number of compressed bytes used by the decompressor
+func (r *FrameReader2) consumed() int64 {
+	return r.counter.n - int64(r.section.Buffered())
+}
+
+// sectionError turns an error of the decompressor into a BrokenSectionError
+func (r *FrameReader2) sectionError(err error, offset int64) error {
+	if _, ok := err.(*BrokenSectionError); ok || err == io.EOF {
+		return err
+	}
+	if err == io.ErrUnexpectedEOF {
+		return brokenSection(r.name, offset, "truncated compressed stream")
+	}
+	return brokenSection(r.name, offset, "%s", err)
+}
+
+func (r *FrameReader2) ReadUvarint() (uint64, error) {
+	offset := r.readed
+	v, err := readUvarint(r.reader, &r.readed, r.name)
+	if err == io.EOF {
+		// the decompressed stream must end with the section
+		if consumed := r.consumed(); consumed != r.length {
+			return 0, brokenSection(r.name, r.readed, "compressed stream ends after %d of %d bytes", consumed, r.length)
+		}
+		return 0, io.EOF
+	}
+	if err != nil {
+		return 0, r.sectionError(err, offset)
+	}
+	return v, nil
+}
+
+func (r *FrameReader2) ReadFrame() ([]byte, error) {
+	offset := r.readed
+
+	length, err := r.ReadUvarint()
+	if err != nil {
+		return nil, err
+	}
+
+	// the decompressed size is not known, only the frame size is limited
+	max := maxFrameSize(r.MaxFrameSize)
+	if length > uint64(max) {
+		return nil, brokenSection(r.name, offset, "frame of %d bytes is larger than max frame size %d", length, max)
+	}
+
+	r.buffer = frameBuffer(r.buffer, int(length), max)
+	n, err := io.ReadFull(r.reader, r.buffer)
+	r.readed += int64(n)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, brokenSection(r.name, offset, "truncated frame of %d bytes", length)
+	}
+	if err != nil {
+		return nil, r.sectionError(err, offset)
+	}
+
+	return r.buffer, nil
+}
+
+func (r *FrameReader2) ReadMessage(msg proto.Message) error {
+	body, err := r.ReadFrame()
+	if err != nil {
+		return err
+	}
+	if err = proto.Unmarshal(body, msg); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,271 @@
+package fsimage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/golang/snappy"
+)
+
+// frames returns varint delimited frames
+func frames(bodies ...string) []byte {
+	var b bytes.Buffer
+	var l [binary.MaxVarintLen64]byte
+	for _, body := range bodies {
+		b.Write(l[:binary.PutUvarint(l[:], uint64(len(body)))])
+		b.WriteString(body)
+	}
+	return b.Bytes()
+}
+
+// readFrames reads all frames of r, the error is nil at the section end
+func readFrames(r IFrameReader) ([]string, error) {
+	var res []string
+	for {
+		frame, err := r.ReadFrame()
+		if err == io.EOF {
+			return res, nil
+		}
+		if err != nil {
+			return res, err
+		}
+		res = append(res, string(frame))
+	}
+}
+
+func TestFrameReader(t *testing.T) {
+	tests := []struct {
+		name    string
+		section []byte
+		max     int64
+		frames  int
+		offset  int64
+		reason  string
+	}{
+		{"frames", frames("a", "", strings.Repeat("b", 300)), 0, 3, 0, ""},
+		{"frame after section end", append(frames("a"), 5, 'x'), 0, 1, 2, "ends after the section end"},
+		{"frame over max size", frames("abc", "abcdef"), 5, 1, 4, "larger than max frame size 5"},
+		{"truncated varint", append(frames("a"), 0x80), 0, 1, 2, "truncated varint"},
+		{"long varint", append(frames("a"), bytes.Repeat([]byte{0x80}, 11)...), 0, 1, 2, "varint is longer"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := append([]byte("head"), tt.section...)
+			r, err := NewFrameReader(bytes.NewReader(data), 4, int64(len(tt.section)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.name = "INODE"
+			r.MaxFrameSize = tt.max
+
+			got, err := readFrames(r)
+			if len(got) != tt.frames {
+				t.Errorf("frames = %d, want %d", len(got), tt.frames)
+			}
+			checkBrokenSection(t, err, tt.offset, tt.reason)
+		})
+	}
+}
+
+func checkBrokenSection(t *testing.T, err error, offset int64, reason string) {
+	t.Helper()
+	if reason == "" {
+		if err != nil {
+			t.Errorf("error %v", err)
+		}
+		return
+	}
+	var e *BrokenSectionError
+	if !errors.As(err, &e) || !errors.Is(err, ErrorBrokenSection) {
+		t.Fatalf("error %v is not a BrokenSectionError", err)
+	}
+	if e.Section != "INODE" || e.Offset != offset || !strings.Contains(e.Reason, reason) {
+		t.Errorf("error %v, want offset %d and %q", err, offset, reason)
+	}
+}
+
+func zlibSection(data []byte) []byte {
+	var b bytes.Buffer
+	w := zlib.NewWriter(&b)
+	w.Write(data)
+	w.Close()
+	return b.Bytes()
+}
+
+func TestFrameReader2CompressedLength(t *testing.T) {
+	section := zlibSection(frames("a", "bc"))
+
+	tests := []struct {
+		name    string
+		section []byte
+		frames  int
+		offset  int64
+		reason  string
+	}{
+		{"section", section, 2, 0, ""},
+		{"bytes after the compressed stream", append(append([]byte(nil), section...), 1, 2, 3), 2, 5, "compressed stream ends after"},
+		{"truncated compressed stream", section[:len(section)-6], 2, 5, "truncated compressed stream"},
+		{"truncated frame", zlibSection(append(frames("a"), 3, 'b')), 1, 2, "truncated frame of 3 bytes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewFrameReader2(bytes.NewReader(tt.section), 0, int64(len(tt.section)), "org.apache.hadoop.io.compress.DefaultCodec", 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.name = "INODE"
+
+			got, err := readFrames(r)
+			if len(got) != tt.frames {
+				t.Errorf("frames = %d, want %d", len(got), tt.frames)
+			}
+			checkBrokenSection(t, err, tt.offset, tt.reason)
+		})
+	}
+}
+
+// lz4Literals returns an LZ4 block of up to 14 literals
+func lz4Literals(data []byte) []byte {
+	return append([]byte{byte(len(data) << 4)}, data...)
+}
+
+func TestFrameReader2Codecs(t *testing.T) {
+	// one frame of fields.c, its length and its body are LZ4 chunks, the
+	// body compressed by the LZ4 library, see lz4/testdata/gen.go
+	fields, err := ioutil.ReadFile("../lzo/testdata/fields.c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fieldsLz4, err := ioutil.ReadFile("../lz4/testdata/fields.c.lz4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	head := frames(string(fields))[:2]
+	section := frames("a", "bc", string(fields))
+
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write(section)
+	w.Close()
+
+	tests := []struct {
+		codec   string
+		section []byte
+		frames  []string
+	}{
+		{"org.apache.hadoop.io.compress.DefaultCodec", zlibSection(section), []string{"a", "bc", string(fields)}},
+		{"org.apache.hadoop.io.compress.GzipCodec", gz.Bytes(), []string{"a", "bc", string(fields)}},
+		{"org.apache.hadoop.io.compress.SnappyCodec", block(uint32(len(section)), snappy.Encode(nil, section)), []string{"a", "bc", string(fields)}},
+		{"org.apache.hadoop.io.compress.Lz4Codec", block(uint32(len(head)+len(fields)), lz4Literals(head), fieldsLz4), []string{string(fields)}},
+	}
+
+	for _, tt := range tests {
+		for _, workers := range []int{1, 4} {
+			r, err := NewFrameReader2(bytes.NewReader(tt.section), 0, int64(len(tt.section)), tt.codec, workers)
+			if err != nil {
+				t.Fatalf("%s: %v", tt.codec, err)
+			}
+			got, err := readFrames(r)
+			if err != nil {
+				t.Errorf("%s, %d workers: %v", tt.codec, workers, err)
+			}
+			if strings.Join(got, "|") != strings.Join(tt.frames, "|") {
+				t.Errorf("%s, %d workers: %d frames differ from %d", tt.codec, workers, len(got), len(tt.frames))
+			}
+		}
+	}
+
+	_, err = NewFrameReader2(bytes.NewReader(section), 0, int64(len(section)), "org.example.Codec", 1)
+	var e *UnknownCodecError
+	if !errors.As(err, &e) || !errors.Is(err, ErrorUnknownCodec) || e.Codec != "org.example.Codec" {
+		t.Errorf("unknown codec: error %v", err)
+	}
+	if err != nil && err.Error() != `unknown compression codec "org.example.Codec"` {
+		t.Errorf("unknown codec: message %q", err)
+	}
+}
+
+func TestFrameBuffer(t *testing.T) {
+	tests := []struct {
+		cap, n int
+		max    int64
+		minCap int
+	}{
+		{0, 10, DefaultMaxFrameSize, minFrameBuffer},
+		{minFrameBuffer, minFrameBuffer + 1, DefaultMaxFrameSize, 2 * minFrameBuffer},
+		{minFrameBuffer, 5 * minFrameBuffer, DefaultMaxFrameSize, 5 * minFrameBuffer},
+		{minFrameBuffer, minFrameBuffer + 1, minFrameBuffer + 1, minFrameBuffer + 1},
+		{100, 50, DefaultMaxFrameSize, 100},
+	}
+
+	for _, tt := range tests {
+		buf := frameBuffer(make([]byte, 0, tt.cap), tt.n, tt.max)
+		if len(buf) != tt.n || cap(buf) < tt.minCap || int64(cap(buf)) > tt.max && cap(buf) > tt.n {
+			t.Errorf("frameBuffer(cap %d, %d, %d): len %d cap %d", tt.cap, tt.n, tt.max, len(buf), cap(buf))
+		}
+	}
+}
+
+// block returns a block of BlockCompressorStream with the given chunks
+func block(size uint32, chunks ...[]byte) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, size)
+	for _, c := range chunks {
+		binary.Write(&b, binary.BigEndian, uint32(len(c)))
+		b.Write(c)
+	}
+	return b.Bytes()
+}
+
+func TestBlockReader(t *testing.T) {
+	first := snappy.Encode(nil, []byte("hello "))
+	second := snappy.Encode(nil, []byte("world"))
+
+	tests := []struct {
+		name   string
+		stream []byte
+		want   string
+		err    string
+	}{
+		{"blocks", append(block(11, first, second), block(5, second)...), "hello worldworld", ""},
+		{"empty block", append(block(0), block(5, second)...), "world", ""},
+		{"block ends early", block(12, first, second), "hello world", "block ends after 11 of 12 bytes"},
+		{"truncated length", append(block(5, second), 0, 0), "world", "truncated block length"},
+		{"truncated chunk", block(11, first, second)[:20], "hello ", "truncated chunk"},
+		{"huge block", block(maxBlockSize + 1), "", "larger than"},
+		{"chunk over block size", block(3, first), "", "can't decompress chunk"},
+		{"corrupt chunk", block(6, []byte{6, 1, 2}), "", "can't decompress chunk"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewBlockReader(bytes.NewReader(tt.stream), snappy_decompress)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := readAll(r)
+			if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("error %v, want %q", err, tt.err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("read %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// readAll reads r till an error, io.EOF is nil
+func readAll(r io.Reader) ([]byte, error) {
+	var b bytes.Buffer
+	_, err := io.Copy(&b, r)
+	return b.Bytes(), err
+}
@@ -0,0 +1,142 @@
+// Package fsimage decodes HDFS fsimage files written in the protobuf format.
+package fsimage
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/lomik/hdfs-fsimage-dump/pb/hadoop_hdfs_fsimage"
+)
+
+const (
+	RootInodeID    = 16385
+	DetachedPrefix = "(detached)"
+	SnapshotPrefix = "(snapshot)"
+	UnknownName    = "(unknown)"
+)
+
+type IFrameReader interface {
+	ReadFrame() ([]byte, error)
+	ReadMessage(msg proto.Message) error
+	ReadUvarint() (uint64, error)
+}
+
+// Image is an opened fsimage with its FileSummary already decoded.
+type Image struct {
+	reader   io.ReaderAt
+	size     int64
+	closer   io.Closer
+	Summary  *pb.FileSummary
+	Codec    string
+	Sections map[string]*pb.FileSummary_Section
+	// MaxFrameSize limits one frame of a section, DefaultMaxFrameSize if 0
+	MaxFrameSize int64
+	// DecompressWorkers is the number of goroutines decompressing blocks of
+	// Snappy, LZO and LZ4 sections, blocks are decompressed in order if <= 1
+	DecompressWorkers int
+}
+
+// Open opens the fsimage file fileName. The caller must Close it.
+func Open(fileName string) (*Image, error) {
+	fInfo, err := os.Stat(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := New(f, fInfo.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	img.closer = f
+	return img, nil
+}
+
+// New reads the FileSummary of the fsimage stored in r with the given size.
+func New(r io.ReaderAt, size int64) (*Image, error) {
+	img := &Image{
+		reader: r,
+		size:   size,
+	}
+
+	summary, err := readSummary(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	img.Summary = summary
+	img.Codec = summary.GetCodec()
+	img.Sections = make(map[string]*pb.FileSummary_Section)
+	for _, value := range summary.GetSections() {
+		img.Sections[value.GetName()] = value
+	}
+
+	return img, nil
+}
+
+// Close closes the underlying file if the image was created by Open.
+func (img *Image) Close() error {
+	if img.closer == nil {
+		return nil
+	}
+	return img.closer.Close()
+}
+
+// Section returns the FileSummary entry for the section name or nil.
+func (img *Image) Section(name string) *pb.FileSummary_Section {
+	return img.Sections[name]
+}
+
+// NewSectionReader returns a frame reader over the (decompressed) section name.
+func (img *Image) NewSectionReader(name string) (IFrameReader, error) {
+	var fr IFrameReader
+
+	info := img.Sections[name]
+	if img.Codec == "" {
+		r, err := NewFrameReader(img.reader, int64(info.GetOffset()), int64(info.GetLength()))
+		if err != nil {
+			return nil, err
+		}
+		r.name = name
+		r.MaxFrameSize = img.MaxFrameSize
+		fr = r
+	} else {
+		r, err := NewFrameReader2(img.reader, int64(info.GetOffset()), int64(info.GetLength()), img.Codec, img.DecompressWorkers)
+		if err != nil {
+			return nil, err
+		}
+		r.name = name
+		r.MaxFrameSize = img.MaxFrameSize
+		fr = r
+	}
+	return fr, nil
+}
+
+func readSummary(imageFile io.ReaderAt, fileLength int64) (*pb.FileSummary, error) {
+
+	var summaryLength int32
+	err := binary.Read(io.NewSectionReader(imageFile, fileLength-4, 4), binary.BigEndian, &summaryLength)
+	if err != nil {
+		return nil, err
+	}
+
+	fr, err := NewFrameReader(imageFile, fileLength-int64(summaryLength)-4, int64(summaryLength))
+	if err != nil {
+		return nil, err
+	}
+
+	fileSummary := &pb.FileSummary{}
+	if err = fr.ReadMessage(fileSummary); err != nil {
+		return nil, err
+	}
+
+	return fileSummary, nil
+}
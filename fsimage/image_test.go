@@ -0,0 +1,161 @@
+package fsimage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	pbh "github.com/lomik/hdfs-fsimage-dump/pb/hadoop_hdfs"
+	pb "github.com/lomik/hdfs-fsimage-dump/pb/hadoop_hdfs_fsimage"
+)
+
+// testImage builds an fsimage in memory. Sections the namespace loader needs
+// are added by bytes if they are not set.
+type testImage struct {
+	names    []string
+	sections map[string]*bytes.Buffer
+	// codec compresses every section with zlib if set, like DefaultCodec
+	codec string
+}
+
+func newTestImage() *testImage {
+	return &testImage{sections: make(map[string]*bytes.Buffer)}
+}
+
+// add appends varint delimited messages to section name
+func (b *testImage) add(t testing.TB, name string, msgs ...proto.Message) {
+	for _, m := range msgs {
+		data, err := proto.Marshal(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.addRaw(name, data)
+	}
+}
+
+func (b *testImage) addRaw(name string, data []byte) {
+	s, ok := b.sections[name]
+	if !ok {
+		s = &bytes.Buffer{}
+		b.sections[name] = s
+		b.names = append(b.names, name)
+	}
+	var l [binary.MaxVarintLen64]byte
+	s.Write(l[:binary.PutUvarint(l[:], uint64(len(data)))])
+	s.Write(data)
+}
+
+// bytes returns the image file
+func (b *testImage) bytes(t testing.TB) []byte {
+	if _, ok := b.sections["STRING_TABLE"]; !ok {
+		b.add(t, "STRING_TABLE", &pb.StringTableSection{NumEntry: proto.Uint32(2)},
+			&pb.StringTableSection_Entry{Id: proto.Uint32(1), Str: proto.String("hdfs")},
+			&pb.StringTableSection_Entry{Id: proto.Uint32(2), Str: proto.String("supergroup")})
+	}
+	if _, ok := b.sections["SNAPSHOT"]; !ok {
+		b.add(t, "SNAPSHOT", &pb.SnapshotSection{})
+	}
+
+	var img bytes.Buffer
+	img.WriteString("HDFSIMG1")
+	summary := &pb.FileSummary{OndiskVersion: proto.Uint32(1), LayoutVersion: proto.Uint32(4294967233)}
+	if b.codec != "" {
+		summary.Codec = proto.String(b.codec)
+	}
+	for _, name := range b.names {
+		data := b.sections[name].Bytes()
+		if b.codec != "" {
+			data = zlibSection(data)
+		}
+		summary.Sections = append(summary.Sections, &pb.FileSummary_Section{
+			Name:   proto.String(name),
+			Offset: proto.Uint64(uint64(img.Len())),
+			Length: proto.Uint64(uint64(len(data))),
+		})
+		img.Write(data)
+	}
+	sum := newTestImage()
+	sum.add(t, "summary", summary)
+	img.Write(sum.sections["summary"].Bytes())
+	binary.Write(&img, binary.BigEndian, int32(sum.sections["summary"].Len()))
+	return img.Bytes()
+}
+
+// open returns the built image
+func (b *testImage) open(t testing.TB) *Image {
+	data := b.bytes(t)
+	img, err := New(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+// testPermission is hdfs:supergroup with mode
+func testPermission(mode uint64) *uint64 {
+	return proto.Uint64(1<<40 | 2<<16 | mode)
+}
+
+func testDir(id uint64, name string) *pb.INodeSection_INode {
+	return &pb.INodeSection_INode{
+		Type: pb.INodeSection_INode_DIRECTORY.Enum(),
+		Id:   proto.Uint64(id),
+		Name: []byte(name),
+		Directory: &pb.INodeSection_INodeDirectory{
+			ModificationTime: proto.Uint64(1505725539089),
+			NsQuota:          proto.Uint64(^uint64(0)),
+			DsQuota:          proto.Uint64(^uint64(0)),
+			Permission:       testPermission(0755),
+		},
+	}
+}
+
+func testFile(id uint64, name string, sizes ...uint64) *pb.INodeSection_INode {
+	f := &pb.INodeSection_INodeFile{
+		Replication:        proto.Uint32(3),
+		ModificationTime:   proto.Uint64(1505725539089),
+		AccessTime:         proto.Uint64(1505725539089),
+		PreferredBlockSize: proto.Uint64(134217728),
+		Permission:         testPermission(0644),
+	}
+	for i, size := range sizes {
+		f.Blocks = append(f.Blocks, &pbh.BlockProto{
+			BlockId:  proto.Uint64(1073741825 + id*16 + uint64(i)),
+			GenStamp: proto.Uint64(1001),
+			NumBytes: proto.Uint64(size),
+		})
+	}
+	return &pb.INodeSection_INode{
+		Type: pb.INodeSection_INode_FILE.Enum(),
+		Id:   proto.Uint64(id),
+		Name: []byte(name),
+		File: f,
+	}
+}
+
+// addTree adds the INODE section with inodes in the given order and the INODE_DIR
+// section with children of every parent
+func (b *testImage) addTree(t testing.TB, inodes []*pb.INodeSection_INode, children map[uint64][]uint64) {
+	last := uint64(0)
+	for _, inode := range inodes {
+		if inode.GetId() > last {
+			last = inode.GetId()
+		}
+	}
+	b.add(t, "INODE", &pb.INodeSection{LastInodeId: proto.Uint64(last), NumInodes: proto.Uint64(uint64(len(inodes)))})
+	for _, inode := range inodes {
+		b.add(t, "INODE", inode)
+	}
+
+	for _, inode := range inodes {
+		if c, ok := children[inode.GetId()]; ok {
+			b.add(t, "INODE_DIR", &pb.INodeDirectorySection_DirEntry{Parent: proto.Uint64(inode.GetId()), Children: c})
+		}
+	}
+	if _, ok := b.sections["INODE_DIR"]; !ok {
+		b.sections["INODE_DIR"] = &bytes.Buffer{}
+		b.names = append(b.names, "INODE_DIR")
+	}
+}
@@ -0,0 +1,221 @@
+package fsimage
+
+import (
+	"encoding/binary"
+	"io"
+
+	pb "github.com/lomik/hdfs-fsimage-dump/pb/hadoop_hdfs_fsimage"
+)
+
+// inodePass reads the INODE section once. Directory names are put into the tree
+// in section order and inodes are returned together with their resolved paths.
+// An inode with an ancestor not named yet is held back together with all inodes
+// after it, so inodes come in section order. In unordered mode only such inodes are
+// held back and the following inodes go first.
+type inodePass struct {
+	inodes      *INodeReader
+	ns          *Namespace
+	snapCleanup bool
+	unordered   bool
+	// root gives the root directory the path "/"
+	root bool
+	// encoded zone xattr, see Namespace.zoneXAttr
+	zoneXAttr []byte
+	eof       bool
+	// named is set if a directory got its name since the held back inodes were tried
+	named    bool
+	deferred deferredFrames
+}
+
+func (img *Image) newINodePass(ns *Namespace, snapCleanup bool, unordered bool) (*inodePass, error) {
+	inodes, err := img.NewINodeReader()
+	if err != nil {
+		return nil, err
+	}
+
+	p := &inodePass{
+		inodes:      inodes,
+		ns:          ns,
+		snapCleanup: snapCleanup,
+		unordered:   unordered,
+		zoneXAttr:   ns.zoneXAttr(),
+		deferred:    deferredFrames{limit: deferredMemory},
+	}
+	if ns.storage.spill() {
+		p.deferred.dir = ns.storage.dir
+		p.deferred.limit = 0
+	}
+	return p, nil
+}
+
+// next returns the next encoded inode with its paths or io.EOF. The frame is valid until the following call.
+func (p *inodePass) next() ([]byte, []Path, error) {
+	for {
+		if p.deferred.len() > 0 && (p.named || p.eof) {
+			frame, paths, err := p.nextDeferred()
+			if err != nil || frame != nil {
+				return frame, paths, err
+			}
+		}
+		if p.eof {
+			return nil, nil, io.EOF
+		}
+
+		frame, err := p.inodes.NextFrame()
+		if err == io.EOF {
+			p.eof = true
+			p.ns.Tree.nameAllSnapshots()
+			if err = p.ns.storage.Err(); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		typ, id, name, err := parseINodeHeader(frame)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if typ == pb.INodeSection_INode_DIRECTORY {
+			if err = p.ns.Tree.SetName(id, 0, name); err != nil {
+				if err = p.ns.handle(err, "INODE"); err != nil {
+					return nil, nil, err
+				}
+				continue
+			}
+			if err = p.ns.storage.Err(); err != nil {
+				return nil, nil, err
+			}
+			p.named = true
+			if err = p.ns.addZone(frame, p.zoneXAttr); err != nil {
+				if err = p.ns.handle(err, "INODE"); err != nil {
+					return nil, nil, err
+				}
+				continue
+			}
+		}
+
+		if p.deferred.len() > 0 && !p.unordered {
+			if err = p.deferred.push(frame); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+
+		paths, err := p.resolve(typ, id, name, true)
+		if err == errorPending {
+			if err = p.deferred.push(frame); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		if err != nil {
+			if err = p.ns.handle(err, "INODE"); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		return frame, paths, nil
+	}
+}
+
+// nextDeferred returns the oldest held back inode if its ancestors are named,
+// nil frame if it still waits
+func (p *inodePass) nextDeferred() ([]byte, []Path, error) {
+	for p.deferred.len() > 0 {
+		frame, err := p.deferred.front()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		typ, id, name, err := parseINodeHeader(frame)
+		if err != nil {
+			return nil, nil, err
+		}
+		paths, err := p.resolve(typ, id, name, !p.eof)
+		if err == errorPending {
+			p.named = false
+			return nil, nil, nil
+		}
+		if perr := p.deferred.pop(); perr != nil {
+			return nil, nil, perr
+		}
+		if err != nil {
+			if err = p.ns.handle(err, "INODE"); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		return frame, paths, nil
+	}
+	return nil, nil, nil
+}
+
+// resolve returns the paths of an inode, see Namespace.resolve
+func (p *inodePass) resolve(typ pb.INodeSection_INode_Type, id uint64, name []byte, strict bool) ([]Path, error) {
+	if p.root && id == RootInodeID && typ == pb.INodeSection_INode_DIRECTORY {
+		return []Path{{Path: "/", Zone: p.ns.zoneOf(id)}}, nil
+	}
+	return p.ns.resolve(typ, id, name, p.snapCleanup, strict)
+}
+
+// close releases the temp file of deferred frames
+func (p *inodePass) close() {
+	p.deferred.close()
+}
+
+// parseINodeHeader reads type, id and name of an encoded INodeSection.INode without decoding the rest
+func parseINodeHeader(frame []byte) (pb.INodeSection_INode_Type, uint64, []byte, error) {
+	var typ pb.INodeSection_INode_Type
+	var id uint64
+	var name []byte
+
+	i := 0
+	for i < len(frame) {
+		tag, n := binary.Uvarint(frame[i:])
+		if n <= 0 {
+			return 0, 0, nil, ErrorBrokenSection
+		}
+		i += n
+
+		switch tag & 7 {
+		case 0:
+			v, n := binary.Uvarint(frame[i:])
+			if n <= 0 {
+				return 0, 0, nil, ErrorBrokenSection
+			}
+			i += n
+			switch tag >> 3 {
+			case 1:
+				typ = pb.INodeSection_INode_Type(v)
+			case 2:
+				id = v
+			}
+		case 1:
+			i += 8
+		case 2:
+			l, n := binary.Uvarint(frame[i:])
+			if n <= 0 || uint64(len(frame)-i-n) < l {
+				return 0, 0, nil, ErrorBrokenSection
+			}
+			i += n
+			if tag>>3 == 3 {
+				name = frame[i : i+int(l)]
+			}
+			i += int(l)
+		case 5:
+			i += 4
+		default:
+			return 0, 0, nil, ErrorBrokenSection
+		}
+	}
+
+	if i > len(frame) {
+		return 0, 0, nil, ErrorBrokenSection
+	}
+
+	return typ, id, name, nil
+}
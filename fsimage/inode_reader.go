@@ -0,0 +1,44 @@
+package fsimage
+
+import (
+	pb "github.com/lomik/hdfs-fsimage-dump/pb/hadoop_hdfs_fsimage"
+)
+
+// INodeReader is a typed stream over the INODE section.
+type INodeReader struct {
+	fr      IFrameReader
+	inode   *pb.INodeSection_INode
+	Section *pb.INodeSection
+}
+
+// NewINodeReader reads the INODE section header and returns a reader positioned at the first inode.
+func (img *Image) NewINodeReader() (*INodeReader, error) {
+	fr, err := img.NewSectionReader("INODE")
+	if err != nil {
+		return nil, err
+	}
+
+	inodeSection := &pb.INodeSection{}
+	if err = fr.ReadMessage(inodeSection); err != nil {
+		return nil, err
+	}
+
+	return &INodeReader{
+		fr:      fr,
+		inode:   &pb.INodeSection_INode{},
+		Section: inodeSection,
+	}, nil
+}
+
+// Next returns the next inode or io.EOF. The returned inode is reused by the following call.
+func (r *INodeReader) Next() (*pb.INodeSection_INode, error) {
+	if err := r.fr.ReadMessage(r.inode); err != nil {
+		return nil, err
+	}
+	return r.inode, nil
+}
+
+// NextFrame returns the next encoded inode or io.EOF. The frame is valid until the following call.
+func (r *INodeReader) NextFrame() ([]byte, error) {
+	return r.fr.ReadFrame()
+}
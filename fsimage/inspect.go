@@ -0,0 +1,87 @@
+package fsimage
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// SectionNames are the sections written by HDFS, see FSImageFormatProtobuf.SectionName
+var SectionNames = []string{
+	"NS_INFO", "STRING_TABLE", "EXTENDED_ACL", "ERASURE_CODING",
+	"INODE", "INODE_SUB", "INODE_REFERENCE", "INODE_REFERENCE_SUB",
+	"SNAPSHOT", "SNAPSHOT_DIFF", "SNAPSHOT_DIFF_SUB", "INODE_DIR", "INODE_DIR_SUB",
+	"FILES_UNDER_CONSTRUCTION", "SECRET_MANAGER", "CACHE_MANAGER",
+}
+
+// readSections are the sections decoded by this package
+var readSections = map[string]bool{
+	"NS_INFO":                  true,
+	"STRING_TABLE":             true,
+	"INODE":                    true,
+	"INODE_REFERENCE":          true,
+	"SNAPSHOT":                 true,
+	"SNAPSHOT_DIFF":            true,
+	"INODE_DIR":                true,
+	"FILES_UNDER_CONSTRUCTION": true,
+}
+
+// SectionStats describes the frames of one section.
+type SectionStats struct {
+	Name string
+	// Offset and Length of the section in the image file
+	Offset uint64
+	Length uint64
+	// Size is the decompressed size of the frames read
+	Size     uint64
+	Frames   int
+	MaxFrame int
+	// Known is set for sections of HDFS, Read for sections decoded here
+	Known bool
+	Read  bool
+	// Err stops reading the section, the counts are up to it
+	Err error
+}
+
+// InspectSections reads the frames of every section in the order of the
+// FileSummary. An error of one section is kept in its stats.
+func (img *Image) InspectSections() []SectionStats {
+	stats := make([]SectionStats, 0, len(img.Summary.GetSections()))
+	for _, s := range img.Summary.GetSections() {
+		st := SectionStats{
+			Name:   s.GetName(),
+			Offset: s.GetOffset(),
+			Length: s.GetLength(),
+			Read:   readSections[s.GetName()],
+		}
+		for _, name := range SectionNames {
+			if name == st.Name {
+				st.Known = true
+			}
+		}
+		st.Err = img.inspectSection(&st)
+		stats = append(stats, st)
+	}
+	return stats
+}
+
+func (img *Image) inspectSection(st *SectionStats) error {
+	fr, err := img.NewSectionReader(st.Name)
+	if err != nil {
+		return err
+	}
+	var prefix [binary.MaxVarintLen64]byte
+	for {
+		frame, err := fr.ReadFrame()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		st.Frames++
+		st.Size += uint64(binary.PutUvarint(prefix[:], uint64(len(frame))) + len(frame))
+		if len(frame) > st.MaxFrame {
+			st.MaxFrame = len(frame)
+		}
+	}
+}
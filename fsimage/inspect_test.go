@@ -0,0 +1,71 @@
+package fsimage
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/lomik/hdfs-fsimage-dump/pb/hadoop_hdfs_fsimage"
+)
+
+func TestInspectSections(t *testing.T) {
+	// newImage returns an image with a known, an unknown and a broken section
+	newImage := func(codec string) *Image {
+		b := newTestImage()
+		b.codec = codec
+		b.add(t, "NS_INFO", &pb.NameSystemSection{NamespaceId: proto.Uint32(1)})
+		for _, frame := range []string{"a", "bcdef", "gh"} {
+			b.addRaw("INODE", []byte(frame))
+		}
+		b.addRaw("CACHE_MANAGER", []byte("cache"))
+		b.addRaw("X_PLUGIN", []byte("p1"))
+		b.addRaw("X_PLUGIN", []byte("p2"))
+		// the second frame is cut
+		b.addRaw("SECRET_MANAGER", []byte("x"))
+		b.addRaw("SECRET_MANAGER", []byte("yyy"))
+		b.sections["SECRET_MANAGER"].Truncate(b.sections["SECRET_MANAGER"].Len() - 1)
+		return b.open(t)
+	}
+
+	want := []SectionStats{
+		{Name: "NS_INFO", Size: 3, Frames: 1, MaxFrame: 2, Known: true, Read: true},
+		{Name: "INODE", Size: 11, Frames: 3, MaxFrame: 5, Known: true, Read: true},
+		{Name: "CACHE_MANAGER", Size: 6, Frames: 1, MaxFrame: 5, Known: true},
+		{Name: "X_PLUGIN", Size: 6, Frames: 2, MaxFrame: 2},
+		{Name: "SECRET_MANAGER", Size: 2, Frames: 1, MaxFrame: 1, Known: true, Err: ErrorBrokenSection},
+		{Name: "STRING_TABLE", Size: 27, Frames: 3, MaxFrame: 14, Known: true, Read: true},
+		{Name: "SNAPSHOT", Size: 1, Frames: 1, MaxFrame: 0, Known: true, Read: true},
+	}
+
+	for _, codec := range []string{"", "org.apache.hadoop.io.compress.DefaultCodec"} {
+		img := newImage(codec)
+		stats := img.InspectSections()
+		if len(stats) != len(want) {
+			t.Fatalf("codec %q: %d sections, want %d", codec, len(stats), len(want))
+		}
+		for i, st := range stats {
+			w := want[i]
+			s := img.Summary.GetSections()[i]
+			w.Offset, w.Length = s.GetOffset(), s.GetLength()
+			if codec == "" && w.Err == nil && st.Length != st.Size {
+				t.Errorf("codec %q: %s length %d, size %d", codec, st.Name, st.Length, st.Size)
+			}
+			if !errors.Is(st.Err, w.Err) || w.Err == nil && st.Err != nil {
+				t.Errorf("codec %q: %s error %v, want %v", codec, st.Name, st.Err, w.Err)
+			}
+			st.Err, w.Err = nil, nil
+			if st != w {
+				t.Errorf("codec %q: %+v, want %+v", codec, st, w)
+			}
+		}
+	}
+
+	// counts stop at a frame over the max size
+	img := newImage("")
+	img.MaxFrameSize = 4
+	st := img.InspectSections()[1]
+	if st.Name != "INODE" || st.Frames != 1 || st.Size != 2 || st.MaxFrame != 1 || !errors.Is(st.Err, ErrorBrokenSection) {
+		t.Errorf("max frame size: %+v", st)
+	}
+}
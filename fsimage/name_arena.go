@@ -0,0 +1,58 @@
+package fsimage
+
+// nameChunkSize is the size of one arena chunk on the heap and the maximum length of a name
+const nameChunkSize = 1 << 20
+
+// spillChunkSize is the size of one memory mapped arena chunk. Chunks are sparse
+// files, big chunks keep the number of mappings of a huge namespace low
+// (vm.max_map_count).
+const spillChunkSize = 256 << 20
+
+// nameArena stores names one after another in big chunks. A name is referenced
+// by its offset in the arena (upper 40 bits) and its length (lower 24 bits).
+type nameArena struct {
+	chunks  [][]byte
+	size    uint64
+	storage *storage
+}
+
+func (a *nameArena) add(name []byte) uint64 {
+	if len(name) == 0 {
+		return 0
+	}
+	if len(name) > nameChunkSize {
+		name = name[:nameChunkSize]
+	}
+
+	size := a.chunkSize()
+	last := len(a.chunks) - 1
+	if last < 0 || uint64(len(a.chunks[last])+len(name)) > size {
+		a.chunks = append(a.chunks, a.storage.alloc(int(size))[:0])
+		last++
+	}
+
+	offset := uint64(last)*size + uint64(len(a.chunks[last]))
+	a.chunks[last] = append(a.chunks[last], name...)
+	a.size += uint64(len(name))
+
+	return offset<<24 | uint64(len(name))
+}
+
+func (a *nameArena) get(ref uint64) []byte {
+	length := ref & (1<<24 - 1)
+	if length == 0 {
+		return nil
+	}
+	offset := ref >> 24
+	size := a.chunkSize()
+	chunk := a.chunks[offset/size]
+	start := offset % size
+	return chunk[start : start+length : start+length]
+}
+
+func (a *nameArena) chunkSize() uint64 {
+	if a.storage.spill() {
+		return spillChunkSize
+	}
+	return nameChunkSize
+}
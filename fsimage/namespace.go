@@ -0,0 +1,178 @@
+package fsimage
+
+import (
+	"fmt"
+	"sync"
+
+	pb "github.com/lomik/hdfs-fsimage-dump/pb/hadoop_hdfs_fsimage"
+)
+
+// Namespace holds everything needed to resolve inode paths and owners.
+type Namespace struct {
+	Tree           *NodeTree
+	InodeReference *NodeRefTree
+	Strings        map[uint32]string
+	zones          map[uint64]*EncryptionZone
+	storage        *storage
+	onError        ErrorHandler
+}
+
+type NamespaceOptions struct {
+	// SnapReplace places snapshots into the virtual directory /(snapshots)
+	SnapReplace bool
+	// SpillDir enables the low memory mode. The inode tree is kept in memory
+	// mapped temp files and inodes read before their parents are kept in a temp
+	// file in this directory.
+	SpillDir string
+	// PathCacheSize is the number of directory paths kept during resolution,
+	// DefaultPathCacheSize if 0, a negative value disables the cache
+	PathCacheSize int
+	// OnError is called for inconsistent inodes, nil stops on the first one
+	OnError ErrorHandler
+}
+
+// LoadNamespace reads all sections except INODE into a Namespace. Independent
+// sections are loaded concurrently. Directory names and snapshot roots are
+// filled in while the INODE section is read by RecordReader or ProcessRecords.
+func (img *Image) LoadNamespace(snapReplace bool) (*Namespace, error) {
+	return img.LoadNamespaceWith(NamespaceOptions{SnapReplace: snapReplace})
+}
+
+// LoadNamespaceWith is LoadNamespace with options. Close the namespace to
+// release the spill files.
+func (img *Image) LoadNamespaceWith(opt NamespaceOptions) (*Namespace, error) {
+	s := newStorage(opt.SpillDir)
+	ns := &Namespace{
+		Tree:           newNodeTree(s),
+		InodeReference: newNodeRefTree(s),
+		Strings:        make(map[uint32]string),
+		zones:          make(map[uint64]*EncryptionZone),
+		storage:        s,
+		onError:        opt.OnError,
+	}
+	if opt.PathCacheSize != 0 {
+		ns.Tree.SetPathCacheSize(opt.PathCacheSize)
+	}
+
+	if err := img.loadNamespace(ns, opt.SnapReplace); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return ns, nil
+}
+
+func (img *Image) loadNamespace(ns *Namespace, snapReplace bool) error {
+	// preallocate the tree for all inode ids
+	inodes, err := img.NewINodeReader()
+	if err != nil {
+		return err
+	}
+	ns.Tree.Grow(inodes.Section.GetLastInodeId())
+	inodes = nil
+	if err = ns.storage.Err(); err != nil {
+		return err
+	}
+
+	// sections are independent of each other, results that need other sections
+	// are collected and merged into the tree after all of them are loaded
+	var refChildren []refChild
+	var diff []snapshotDiffEntry
+	var roots []snapshotRoot
+
+	loaders := []func() error{
+		func() error {
+			return img.ReadStrings(ns.Strings)
+		},
+		func() error {
+			return img.ReadReferenceTree(ns.InodeReference)
+		},
+		func() (err error) {
+			refChildren, err = img.readTree(ns.Tree)
+			return
+		},
+		func() (err error) {
+			diff, err = img.readSnapshotDiff()
+			return
+		},
+		func() (err error) {
+			roots, err = img.readSnapshotRoots()
+			return
+		},
+	}
+
+	errs := make([]error, len(loaders))
+	var wg sync.WaitGroup
+	for i, loader := range loaders {
+		wg.Add(1)
+		go func(i int, loader func() error) {
+			defer wg.Done()
+			errs[i] = loader()
+		}(i, loader)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	applyRefChildren(ns.Tree, ns.InodeReference, refChildren)
+	if err = applySnapshotDiff(ns.Tree, ns.InodeReference, diff, ns.onError); err != nil {
+		return err
+	}
+	ns.Tree.addSnapshots(roots, snapReplace)
+
+	return ns.storage.Err()
+}
+
+// Close releases memory mapped files of the low memory mode. The namespace
+// must not be used afterwards.
+func (ns *Namespace) Close() error {
+	return ns.storage.Close()
+}
+
+// User returns the owner name packed into an inode permission.
+func (ns *Namespace) User(permission uint64) string {
+	return ns.Strings[uint32(permission>>40)]
+}
+
+// Group returns the group name packed into an inode permission.
+func (ns *Namespace) Group(permission uint64) string {
+	return ns.Strings[uint32((permission>>16)%(1<<24))]
+}
+
+// resolve returns paths of a file or directory inode, see NodeTree.resolvePaths
+func (ns *Namespace) resolve(typ pb.INodeSection_INode_Type, id uint64, name []byte, snapCleanup bool, strict bool) ([]Path, error) {
+	var isDir bool
+
+	switch typ {
+	case pb.INodeSection_INode_FILE, pb.INodeSection_INode_SYMLINK:
+	case pb.INodeSection_INode_DIRECTORY:
+		isDir = true
+	default:
+		return nil, nil
+	}
+
+	paths, err := ns.Tree.resolvePaths(id, string(name), isDir, snapCleanup, strict)
+	if err != nil {
+		if e, ok := err.(*NodeError); ok && e.Name == "" {
+			e.Name = string(name)
+		}
+		return nil, err
+	}
+	if len(paths) == 0 && !(isDir && snapCleanup) && id != RootInodeID {
+		paths = append(paths, Path{Path: fmt.Sprintf("/%s/%s", UnknownName, string(name))})
+	}
+	if zone := ns.zoneOf(id); zone != nil {
+		for i := range paths {
+			paths[i].Zone = zone
+		}
+	}
+	return paths, nil
+}
+
+// handle passes an error of one inode to the error handler of the namespace
+func (ns *Namespace) handle(err error, section string) error {
+	return handleNodeError(err, section, ns.onError)
+}
@@ -0,0 +1,449 @@
+package fsimage
+
+import (
+	"unsafe"
+)
+
+type Node struct {
+	Parent uint64
+	Name   []byte
+	SnapId uint32
+}
+
+// NodeTree keeps parent links and names of inodes. The first node of an inode
+// lives in dense arrays indexed by key-RootInodeID, other nodes (snapshot
+// variants) and inodes that do not fit the dense part are kept in extra.
+type NodeTree struct {
+	// parent of the first node encoded by encodeParent, 0 if there is no dense node
+	parents []uint32
+	snaps   []uint32
+	// name of the first node, reference into arena
+	names []uint64
+	arena nameArena
+	extra map[uint64][]Node
+	// resolved paths of directories
+	paths pathCache
+	// allocator of the dense arrays and names
+	storage *storage
+	// snapshot roots waiting for the name of their directory
+	snapshots   map[uint64][]snapshotRoot
+	snapReplace bool
+	// all names are known, set at the end of the INODE section
+	named bool
+}
+
+func NewNodeTree() *NodeTree {
+	return newNodeTree(nil)
+}
+
+func newNodeTree(s *storage) *NodeTree {
+	return &NodeTree{
+		extra:   make(map[uint64][]Node),
+		storage: s,
+		arena:   nameArena{storage: s},
+		paths:   pathCache{size: DefaultPathCacheSize},
+	}
+}
+
+// Grow preallocates the dense part for inode ids up to lastInodeId.
+func (t *NodeTree) Grow(lastInodeId uint64) {
+	if lastInodeId < RootInodeID || lastInodeId-RootInodeID >= maxDenseNodes {
+		return
+	}
+	t.grow(int(lastInodeId - RootInodeID))
+}
+
+const maxDenseNodes = 1<<32 - 1
+
+func denseIndex(key uint64) (int, bool) {
+	if key < RootInodeID || key-RootInodeID >= maxDenseNodes {
+		return 0, false
+	}
+	return int(key - RootInodeID), true
+}
+
+func encodeParent(parent uint64) (uint32, bool) {
+	if parent < RootInodeID || parent-RootInodeID >= maxDenseNodes {
+		return 0, false
+	}
+	return uint32(parent-RootInodeID) + 1, true
+}
+
+func (t *NodeTree) grow(idx int) {
+	if idx < len(t.parents) {
+		return
+	}
+	n := idx + 1
+	if n < 2*len(t.parents) {
+		n = 2 * len(t.parents)
+	}
+	parents := t.storage.uint32s(n)
+	copy(parents, t.parents)
+	t.storage.freeUint32s(t.parents)
+	t.parents = parents
+	snaps := t.storage.uint32s(n)
+	copy(snaps, t.snaps)
+	t.storage.freeUint32s(t.snaps)
+	t.snaps = snaps
+	names := t.storage.uint64s(n)
+	copy(names, t.names)
+	t.storage.freeUint64s(t.names)
+	t.names = names
+}
+
+func (t *NodeTree) dense(key uint64) (int, bool) {
+	idx, ok := denseIndex(key)
+	if !ok || idx >= len(t.parents) || t.parents[idx] == 0 {
+		return 0, false
+	}
+	return idx, true
+}
+
+// count returns number of nodes of key
+func (t *NodeTree) count(key uint64) int {
+	n := 0
+	if _, ok := t.dense(key); ok {
+		n = 1
+	}
+	if len(t.extra) > 0 {
+		n += len(t.extra[key])
+	}
+	return n
+}
+
+// at returns i-th node of key
+func (t *NodeTree) at(key uint64, i int) Node {
+	if idx, ok := t.dense(key); ok {
+		if i == 0 {
+			return Node{
+				Parent: uint64(t.parents[idx]-1) + RootInodeID,
+				Name:   t.arena.get(t.names[idx]),
+				SnapId: t.snaps[idx],
+			}
+		}
+		i--
+	}
+	return t.extra[key][i]
+}
+
+func (t *NodeTree) find(key uint64, snapshot uint32) int {
+	n := t.count(key)
+	for i := 0; i < n; i++ {
+		if t.at(key, i).SnapId == snapshot {
+			return i
+		}
+	}
+	return -1
+}
+
+func (t *NodeTree) setParentAt(key uint64, i int, parent uint64) {
+	if idx, ok := t.dense(key); ok {
+		if i == 0 {
+			if p, ok := encodeParent(parent); ok {
+				t.parents[idx] = p
+				return
+			}
+			// move the first node to extra, its parent does not fit the dense part
+			node := t.at(key, 0)
+			node.Parent = parent
+			t.extra[key] = append([]Node{node}, t.extra[key]...)
+			t.parents[idx] = 0
+			t.names[idx] = 0
+			t.snaps[idx] = 0
+			return
+		}
+		i--
+	}
+	t.extra[key][i].Parent = parent
+}
+
+func (t *NodeTree) setNameAt(key uint64, i int, name []byte) {
+	if idx, ok := t.dense(key); ok {
+		if i == 0 {
+			t.names[idx] = t.arena.add(name)
+			return
+		}
+		i--
+	}
+	t.extra[key][i].Name = t.arena.get(t.arena.add(name))
+}
+
+func (t *NodeTree) add(key uint64, node Node) {
+	if t.count(key) == 0 {
+		idx, ok := denseIndex(key)
+		p, pok := encodeParent(node.Parent)
+		if ok && pok {
+			t.grow(idx)
+			t.parents[idx] = p
+			t.snaps[idx] = node.SnapId
+			t.names[idx] = t.arena.add(node.Name)
+			return
+		}
+	}
+	node.Name = t.arena.get(t.arena.add(node.Name))
+	t.extra[key] = append(t.extra[key], node)
+}
+
+// SetPathCacheSize sets the number of directory paths kept during resolution, 0 disables the cache.
+func (t *NodeTree) SetPathCacheSize(size int) {
+	t.paths = pathCache{size: size}
+}
+
+func (t *NodeTree) SetParent(key uint64, snapshot uint32, parent uint64) {
+	if i := t.find(key, snapshot); i >= 0 {
+		t.setParentAt(key, i, parent)
+		return
+	}
+	t.add(key, Node{Parent: parent, SnapId: snapshot})
+}
+
+// SetName sets the name of key in snapshot or of all its nodes without a name.
+// It returns a NodeError if key is not in the tree.
+func (t *NodeTree) SetName(key uint64, snapshot uint32, name []byte) error {
+
+	if key == RootInodeID {
+		return nil
+	}
+	n := t.count(key)
+	if n > 0 {
+		if i := t.find(key, snapshot); i >= 0 {
+			t.setNameAt(key, i, name)
+			return nil
+		}
+		for i := 0; i < n; i++ {
+			if len(t.at(key, i).Name) == 0 {
+				t.setNameAt(key, i, name)
+			}
+		}
+		return nil
+	}
+	return &NodeError{Id: key, SnapId: snapshot, Name: string(name), Err: ErrorUnknownInode}
+}
+
+func (t *NodeTree) SetParentName(key uint64, snapshot uint32, parent uint64, name []byte) {
+	if i := t.find(key, snapshot); i >= 0 {
+		t.setNameAt(key, i, name)
+		t.setParentAt(key, i, parent)
+		return
+	}
+	t.add(key, Node{Parent: parent, SnapId: snapshot, Name: name})
+}
+
+func (t *NodeTree) GetName(key uint64, snapshot uint32) []byte {
+	if i := t.find(key, snapshot); i >= 0 {
+		return t.at(key, i).Name
+	}
+	return nil
+}
+
+func (t *NodeTree) GetParents(key uint64) []Node {
+	n := t.count(key)
+	ps := make([]Node, n)
+	for i := 0; i < n; i++ {
+		ps[i] = t.at(key, i)
+	}
+	return ps
+}
+
+// getPathsReq returns the path of directory key in snapshot snap, "" for the
+// root. In strict mode it returns false if a name on the way is not known yet.
+func getPathsReq(key uint64, snap uint32, tree *NodeTree, strict bool) (string, bool) {
+
+	if key == RootInodeID {
+		return "", true
+	}
+	if key == 0 {
+		return "/" + UnknownName, true
+	}
+
+	// strict paths do not change anymore, others only after all names are known
+	cache := strict || tree.named
+	ck := pathKey{key: key, snap: snap}
+	if cache {
+		if path, ok := tree.paths.get(ck); ok {
+			return path, true
+		}
+	}
+
+	if !tree.nameSnapshots(key, strict) {
+		return "", false
+	}
+
+	node, nodeSnap, found := tree.pathNode(key, snap)
+	if !found {
+		return "/" + UnknownName, true
+	}
+
+	if strict && len(node.Name) == 0 {
+		return "", false
+	}
+	path, ok := getPathsReq(node.Parent, nodeSnap, tree, strict)
+	if !ok {
+		return "", false
+	}
+	path += "/" + string(node.Name)
+	if cache {
+		tree.paths.put(ck, path)
+	}
+	return path, true
+}
+
+// pathNode chooses the node of key used for paths in snapshot snap: the node of
+// snap, the current node or the node of the latest snapshot.
+func (t *NodeTree) pathNode(key uint64, snap uint32) (Node, uint32, bool) {
+	n := t.count(key)
+
+	for i := 0; i < n; i++ {
+		if node := t.at(key, i); node.SnapId == snap {
+			return node, snap, true
+		}
+	}
+
+	for i := 0; i < n; i++ {
+		if node := t.at(key, i); node.SnapId == 0 {
+			return node, snap, true
+		}
+	}
+
+	// find max snapid
+	maxSnap := uint32(0)
+	for i := 0; i < n; i++ {
+		if node := t.at(key, i); node.SnapId > maxSnap {
+			maxSnap = node.SnapId
+		}
+	}
+	if maxSnap > 0 {
+		for i := 0; i < n; i++ {
+			if node := t.at(key, i); node.SnapId == maxSnap {
+				return node, maxSnap, true
+			}
+		}
+	}
+
+	return Node{}, 0, false
+}
+
+type Path struct {
+	Path   string
+	SnapId uint32
+	// Zone is the encryption zone of the inode, nil outside of zones
+	Zone *EncryptionZone
+}
+
+func (t *NodeTree) GetPaths(key uint64, name string, isDir bool, snapCleanup bool) ([]string, error) {
+	resolved, err := t.ResolvePaths(key, name, isDir, snapCleanup)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, len(resolved))
+	for i := range resolved {
+		paths[i] = resolved[i].Path
+	}
+	return paths, nil
+}
+
+// ResolvePaths is like GetPaths but also returns the snapshot id of every path.
+func (t *NodeTree) ResolvePaths(key uint64, name string, isDir bool, snapCleanup bool) ([]Path, error) {
+	return t.resolvePaths(key, name, isDir, snapCleanup, false)
+}
+
+// resolvePaths returns paths of key. In strict mode it returns errorPending if
+// a name on the way is not known yet.
+func (t *NodeTree) resolvePaths(key uint64, name string, isDir bool, snapCleanup bool, strict bool) ([]Path, error) {
+
+	if !t.nameSnapshots(key, strict) {
+		return nil, errorPending
+	}
+
+	paths := []Path{}
+	ps := t.GetParents(key)
+
+	// snapCleanup mode
+	if snapCleanup && !isDir && len(ps) > 1 {
+		maxSnap := uint32(0)
+		for _, node := range ps {
+			if node.SnapId == 0 {
+				ps = []Node{node}
+				maxSnap = 0
+				break
+			}
+			if node.SnapId > maxSnap {
+				maxSnap = node.SnapId
+			}
+		}
+		if maxSnap > 0 {
+			for _, node := range ps {
+				if node.SnapId == maxSnap {
+					ps = []Node{node}
+					break
+				}
+			}
+		}
+	}
+
+	for _, node := range ps {
+		// skip dirs in snapshot
+		if isDir && node.SnapId != 0 && snapCleanup {
+			continue
+		}
+
+		if len(node.Name) > 0 {
+			name = string(node.Name)
+		}
+
+		parent := node.Parent
+
+		if len(name) == 0 {
+			return nil, &NodeError{Id: key, SnapId: node.SnapId, Err: ErrorEmptyName}
+		}
+
+		dir, ok := getPathsReq(parent, node.SnapId, t, strict)
+		if !ok {
+			return nil, errorPending
+		}
+		paths = append(paths, Path{Path: dir + "/" + name, SnapId: node.SnapId})
+	}
+	return paths, nil
+}
+
+type NodeTreeStats struct {
+	Inodes     int
+	DenseBytes uint64
+	NameBytes  uint64
+	ExtraNodes int
+	ExtraBytes uint64
+}
+
+func (s NodeTreeStats) TotalBytes() uint64 {
+	return s.DenseBytes + s.NameBytes + s.ExtraBytes
+}
+
+func (s NodeTreeStats) BytesPerInode() float64 {
+	if s.Inodes == 0 {
+		return 0
+	}
+	return float64(s.TotalBytes()) / float64(s.Inodes)
+}
+
+// MemStats returns memory used by the tree. Map overhead of extra nodes is estimated.
+func (t *NodeTree) MemStats() NodeTreeStats {
+	var s NodeTreeStats
+
+	for _, p := range t.parents {
+		if p != 0 {
+			s.Inodes++
+		}
+	}
+	s.DenseBytes = uint64(cap(t.parents))*4 + uint64(cap(t.snaps))*4 + uint64(cap(t.names))*8
+	s.NameBytes = uint64(len(t.arena.chunks)) * t.arena.chunkSize()
+
+	for key, nodes := range t.extra {
+		if _, ok := t.dense(key); !ok {
+			s.Inodes++
+		}
+		s.ExtraNodes += len(nodes)
+		s.ExtraBytes += uint64(cap(nodes))*uint64(unsafe.Sizeof(Node{})) + 48
+	}
+
+	return s
+}
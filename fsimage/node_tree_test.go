@@ -0,0 +1,184 @@
+package fsimage
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNodeTreeLayout(t *testing.T) {
+	tests := []struct {
+		name   string
+		key    uint64
+		parent uint64
+		dense  bool
+	}{
+		{"dense", RootInodeID + 1, RootInodeID, true},
+		{"key below root", 1000, RootInodeID, false},
+		{"key above dense range", RootInodeID + maxDenseNodes, RootInodeID, false},
+		{"parent below root", RootInodeID + 2, 1000, false},
+		{"parent above dense range", RootInodeID + 3, RootInodeID + maxDenseNodes + 5, false},
+		{"detached", RootInodeID + 4, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := NewNodeTree()
+			tree.Grow(RootInodeID + 10)
+			tree.SetParent(tt.key, 0, tt.parent)
+			if err := tree.SetName(tt.key, 0, []byte("n")); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, ok := tree.dense(tt.key); ok != tt.dense {
+				t.Errorf("dense = %v, want %v", ok, tt.dense)
+			}
+			if n := len(tree.extra[tt.key]); (n == 0) != tt.dense {
+				t.Errorf("extra nodes = %d", n)
+			}
+			ps := tree.GetParents(tt.key)
+			if len(ps) != 1 || ps[0].Parent != tt.parent || string(ps[0].Name) != "n" || ps[0].SnapId != 0 {
+				t.Errorf("parents = %+v", ps)
+			}
+		})
+	}
+}
+
+func TestNodeTreeSnapshots(t *testing.T) {
+	key := uint64(RootInodeID + 5)
+	tree := NewNodeTree()
+	tree.SetParent(key, 0, RootInodeID+1)
+	tree.SetParent(key, 3, RootInodeID+2)
+	tree.SetParentName(key, 7, RootInodeID+3, []byte("old"))
+	if err := tree.SetName(key, 0, []byte("cur")); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Node{
+		{Parent: RootInodeID + 1, Name: []byte("cur"), SnapId: 0},
+		{Parent: RootInodeID + 2, Name: nil, SnapId: 3},
+		{Parent: RootInodeID + 3, Name: []byte("old"), SnapId: 7},
+	}
+	checkNodes(t, tree.GetParents(key), want)
+	if _, ok := tree.dense(key); !ok {
+		t.Error("the first node is not dense")
+	}
+	if n := len(tree.extra[key]); n != 2 {
+		t.Errorf("extra nodes = %d, want 2", n)
+	}
+
+	// a parent out of the dense range moves the first node to extra
+	tree.SetParent(key, 0, 42)
+	want[0].Parent = 42
+	if _, ok := tree.dense(key); ok {
+		t.Error("the first node is still dense")
+	}
+	checkNodes(t, tree.GetParents(key), want)
+
+	if got := string(tree.GetName(key, 7)); got != "old" {
+		t.Errorf("name in snapshot 7 = %q", got)
+	}
+	if got := tree.GetName(key, 9); got != nil {
+		t.Errorf("name in snapshot 9 = %q", got)
+	}
+}
+
+func checkNodes(t *testing.T, got, want []Node) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("nodes = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i].Parent != want[i].Parent || got[i].SnapId != want[i].SnapId || !bytes.Equal(got[i].Name, want[i].Name) {
+			t.Errorf("node %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestNodeTreeSetNameUnknown(t *testing.T) {
+	tree := NewNodeTree()
+	err := tree.SetName(RootInodeID+1, 0, []byte("lost"))
+	var e *NodeError
+	if !errors.As(err, &e) || e.Id != RootInodeID+1 || e.Name != "lost" || !errors.Is(err, ErrorUnknownInode) {
+		t.Errorf("error = %v", err)
+	}
+	if err = tree.SetName(RootInodeID, 0, nil); err != nil {
+		t.Errorf("root: %v", err)
+	}
+}
+
+func TestNodeTreePaths(t *testing.T) {
+	tree := NewNodeTree()
+	tree.SetParentName(RootInodeID+1, 0, RootInodeID, []byte("user"))
+	tree.SetParentName(RootInodeID+2, 0, RootInodeID+1, []byte("alice"))
+	tree.SetParent(RootInodeID+3, 0, RootInodeID+2)
+	tree.SetParent(RootInodeID+4, 0, RootInodeID+5)
+	tree.SetParent(RootInodeID+5, 0, RootInodeID)
+	tree.SetParent(RootInodeID+6, 0, RootInodeID+9)
+
+	tests := []struct {
+		key    uint64
+		name   string
+		strict bool
+		want   []string
+		err    error
+	}{
+		{RootInodeID + 3, "a.txt", true, []string{"/user/alice/a.txt"}, nil},
+		{RootInodeID + 3, "", true, nil, ErrorEmptyName},
+		{RootInodeID + 4, "b.txt", true, nil, errorPending},
+		{RootInodeID + 6, "b.txt", true, []string{"/" + UnknownName + "/b.txt"}, nil},
+		{RootInodeID + 7, "c.txt", true, []string{}, nil},
+	}
+
+	for _, tt := range tests {
+		paths, err := tree.resolvePaths(tt.key, tt.name, false, false, tt.strict)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%d %q: error %v, want %v", tt.key, tt.name, err, tt.err)
+			continue
+		}
+		var got []string
+		for _, p := range paths {
+			got = append(got, p.Path)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%d %q: paths %v, want %v", tt.key, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNameArena(t *testing.T) {
+	var a nameArena
+	long := bytes.Repeat([]byte("x"), nameChunkSize-10)
+
+	names := [][]byte{[]byte("a"), long, []byte("crosses a chunk"), []byte("b")}
+	refs := make([]uint64, len(names))
+	for i, name := range names {
+		refs[i] = a.add(name)
+	}
+	for i, name := range names {
+		if got := a.get(refs[i]); !bytes.Equal(got, name) {
+			t.Errorf("name %d = %.20q, want %.20q", i, got, name)
+		}
+	}
+	if len(a.chunks) != 2 {
+		t.Errorf("chunks = %d, want 2", len(a.chunks))
+	}
+
+	if ref := a.add(nil); ref != 0 || a.get(ref) != nil {
+		t.Errorf("empty name ref = %d", ref)
+	}
+
+	// names are capped to the chunk size
+	huge := bytes.Repeat([]byte("y"), nameChunkSize+1)
+	if got := a.get(a.add(huge)); len(got) != nameChunkSize {
+		t.Errorf("huge name length = %d", len(got))
+	}
+
+	// appending to a returned name must not overwrite the next name
+	first := a.get(refs[2])
+	_ = append(first, 'z')
+	if got := a.get(refs[3]); string(got) != "b" {
+		t.Errorf("next name = %q", got)
+	}
+}
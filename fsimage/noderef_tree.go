@@ -0,0 +1,72 @@
+package fsimage
+
+// NodeRefTree keeps INODE_REFERENCE entries. Keys are positions in the section,
+// so entries live in dense arrays indexed by key.
+type NodeRefTree struct {
+	refIds  []uint64
+	snaps   []uint32
+	names   []uint64
+	arena   nameArena
+	storage *storage
+}
+
+func NewNodeRefTree() *NodeRefTree {
+	return newNodeRefTree(nil)
+}
+
+func newNodeRefTree(s *storage) *NodeRefTree {
+	return &NodeRefTree{
+		storage: s,
+		arena:   nameArena{storage: s},
+	}
+}
+
+func (t *NodeRefTree) grow(key uint32) {
+	if int(key) < len(t.refIds) {
+		return
+	}
+	n := int(key) + 1
+	if n < 2*len(t.refIds) {
+		n = 2 * len(t.refIds)
+	}
+	refIds := t.storage.uint64s(n)
+	copy(refIds, t.refIds)
+	t.storage.freeUint64s(t.refIds)
+	t.refIds = refIds
+	snaps := t.storage.uint32s(n)
+	copy(snaps, t.snaps)
+	t.storage.freeUint32s(t.snaps)
+	t.snaps = snaps
+	names := t.storage.uint64s(n)
+	copy(names, t.names)
+	t.storage.freeUint64s(t.names)
+	t.names = names
+}
+
+func (t *NodeRefTree) SetRefSnapName(key uint32, snapId uint32, refId uint64, name []byte) {
+	t.grow(key)
+	t.snaps[key] = snapId
+	t.refIds[key] = refId
+	t.names[key] = t.arena.add(name)
+}
+
+func (t *NodeRefTree) GetRefId(key uint32) uint64 {
+	if int(key) < len(t.refIds) {
+		return t.refIds[key]
+	}
+	return 0
+}
+
+func (t *NodeRefTree) GetRefSnapId(key uint32) uint32 {
+	if int(key) < len(t.snaps) {
+		return t.snaps[key]
+	}
+	return 0
+}
+
+func (t *NodeRefTree) GetRefName(key uint32) []byte {
+	if int(key) < len(t.names) {
+		return t.arena.get(t.names[key])
+	}
+	return nil
+}
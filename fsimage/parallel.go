@@ -0,0 +1,178 @@
+package fsimage
+
+import (
+	"bytes"
+	"io"
+	"runtime"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/lomik/hdfs-fsimage-dump/pb/hadoop_hdfs_fsimage"
+)
+
+// INodeBatchSize is the number of inodes handed to a worker at once.
+const INodeBatchSize = 1024
+
+// ProcessFunc serializes records of one inode into out. It is called concurrently from several workers.
+type ProcessFunc func(records []Record, out *bytes.Buffer) error
+
+type ParallelOptions struct {
+	// Workers is the number of decoding goroutines, runtime.NumCPU() if not set
+	Workers int
+	// Unordered allows output in completion order instead of the INODE section order.
+	// Inodes met before their ancestor directories are then returned later instead of
+	// holding back all inodes after them.
+	Unordered   bool
+	SnapCleanup bool
+	// Root adds a record of the root directory with path "/". The root has
+	// no name and no path of its own, so it has no record otherwise.
+	Root bool
+}
+
+type recordBatch struct {
+	seq     int
+	data    []byte
+	offsets []int
+	paths   [][]Path
+	out     bytes.Buffer
+	err     error
+}
+
+func (b *recordBatch) frame(i int) []byte {
+	if i+1 < len(b.offsets) {
+		return b.data[b.offsets[i]:b.offsets[i+1]]
+	}
+	return b.data[b.offsets[i]:]
+}
+
+// ProcessRecords reads the INODE section once, resolves paths and calls process on a pool of workers.
+// Serialized batches are written to w in the order of RecordReader unless opt.Unordered is set.
+func (img *Image) ProcessRecords(ns *Namespace, opt ParallelOptions, process ProcessFunc, w io.Writer) error {
+	pass, err := img.newINodePass(ns, opt.SnapCleanup, opt.Unordered)
+	if err != nil {
+		return err
+	}
+	pass.root = opt.Root
+
+	workers := opt.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	// tokens limit batches which are read but not written yet
+	tokens := make(chan struct{}, workers*4)
+	batches := make(chan *recordBatch, workers)
+	results := make(chan *recordBatch, workers)
+	done := make(chan struct{})
+
+	var readErr error
+
+	go func() {
+		defer close(batches)
+		defer pass.close()
+		for seq := 0; ; seq++ {
+			b := &recordBatch{seq: seq}
+			for len(b.offsets) < INodeBatchSize {
+				frame, paths, err := pass.next()
+				if err != nil {
+					if err != io.EOF {
+						readErr = err
+					}
+					break
+				}
+				b.offsets = append(b.offsets, len(b.data))
+				b.data = append(b.data, frame...)
+				b.paths = append(b.paths, paths)
+			}
+			if len(b.offsets) == 0 {
+				return
+			}
+
+			select {
+			case tokens <- struct{}{}:
+			case <-done:
+				return
+			}
+			select {
+			case batches <- b:
+			case <-done:
+				return
+			}
+
+			if len(b.offsets) < INodeBatchSize {
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			inode := &pb.INodeSection_INode{}
+			var records []Record
+			for b := range batches {
+				for i := 0; i < len(b.offsets) && b.err == nil; i++ {
+					if err := proto.Unmarshal(b.frame(i), inode); err != nil {
+						b.err = ns.handle(decodeError(b.frame(i), err), "INODE")
+						continue
+					}
+					records = ns.appendRecords(records[:0], inode, b.paths[i])
+					if len(records) > 0 {
+						b.err = process(records, &b.out)
+					}
+				}
+				results <- b
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	pending := make(map[int]*recordBatch)
+	next := 0
+
+	write := func(b *recordBatch) {
+		if err == nil {
+			err = b.err
+		}
+		if err == nil {
+			_, err = w.Write(b.out.Bytes())
+		}
+		if err != nil {
+			select {
+			case <-done:
+			default:
+				close(done)
+			}
+		}
+		<-tokens
+	}
+
+	for b := range results {
+		if opt.Unordered {
+			write(b)
+			continue
+		}
+		pending[b.seq] = b
+		for {
+			b, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			write(b)
+			next++
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+	return readErr
+}
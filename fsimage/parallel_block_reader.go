@@ -0,0 +1,250 @@
+package fsimage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// DecodedLen returns the decompressed size of a chunk without decompressing
+// it, like snappy.DecodedLen reading the size from the chunk header or
+// lzo.DecodedLen1X parsing the chunk without writing the output
+type DecodedLen func(src []byte) (int, error)
+
+// ParallelBlockReader reads the same block framing as BlockReader, but
+// decompresses up to workers blocks at once on separate goroutines. Blocks are
+// read ahead in Read, and decoded blocks are returned in stream order.
+// decodedLen finds the end of a block on the reading goroutine, so it must be
+// cheap next to decompress.
+type ParallelBlockReader struct {
+	reader     io.Reader
+	decompress Decompress
+	decodedLen DecodedLen
+	workers    int
+	// blocks read ahead, in stream order
+	pending []*decodeBlock
+	// block being read and its bytes not read yet
+	current *decodeBlock
+	buff    []byte
+	// compressed bytes read
+	readed int64
+	// error of the compressed stream, returned after the pending blocks
+	err error
+}
+
+// decodeBlock is one block of the stream with its compressed chunks
+type decodeBlock struct {
+	data   []byte
+	chunks []decodeChunk
+	out    []byte
+	err    error
+	done   chan struct{}
+}
+
+type decodeChunk struct {
+	// compressed offset of the chunk length
+	offset int64
+	// chunk in data and its decoded part in out
+	src, dst [2]int
+}
+
+// blockBuffers keeps compressed and decompressed buffers of finished blocks
+var blockBuffers sync.Pool
+
+func getBlockBuffer(size int) []byte {
+	if b, ok := blockBuffers.Get().(*[]byte); ok && cap(*b) >= size {
+		return (*b)[:size]
+	}
+	return make([]byte, size)
+}
+
+func putBlockBuffer(b []byte) {
+	if cap(b) > 0 {
+		blockBuffers.Put(&b)
+	}
+}
+
+func NewParallelBlockReader(r io.Reader, decompress Decompress, decodedLen DecodedLen, workers int) (io.Reader, error) {
+	if workers < 1 {
+		workers = 1
+	}
+	return &ParallelBlockReader{
+		reader:     r,
+		decompress: decompress,
+		decodedLen: decodedLen,
+		workers:    workers,
+	}, nil
+}
+
+func (r *ParallelBlockReader) Read(b []byte) (n int, err error) {
+	if len(b) <= 0 {
+		return 0, nil
+	}
+	for len(r.buff) == 0 {
+		if err = r.nextBlock(); err != nil {
+			return 0, err
+		}
+	}
+	n = copy(b, r.buff)
+	r.buff = r.buff[n:]
+	return n, nil
+}
+
+// nextBlock releases the current block, fills the pipeline and waits for the
+// next block in order
+func (r *ParallelBlockReader) nextBlock() error {
+	if r.current != nil {
+		putBlockBuffer(r.current.out)
+		r.current = nil
+	}
+
+	for r.err == nil && len(r.pending) < r.workers {
+		block, err := r.readBlock()
+		if err != nil {
+			r.err = err
+			break
+		}
+		r.pending = append(r.pending, block)
+		go block.decode(r.decompress)
+	}
+
+	if len(r.pending) == 0 {
+		return r.err
+	}
+	block := r.pending[0]
+	copy(r.pending, r.pending[1:])
+	r.pending = r.pending[:len(r.pending)-1]
+
+	<-block.done
+	if block.err != nil {
+		// blocks after a broken one are dropped when they are done
+		block.release()
+		for _, b := range r.pending {
+			<-b.done
+			b.release()
+		}
+		r.pending = nil
+		r.err = block.err
+		return r.err
+	}
+	r.current = block
+	r.buff = block.out
+	return nil
+}
+
+// readLength reads a big endian length. io.EOF means there are no more bytes.
+func (r *ParallelBlockReader) readLength() (uint32, error) {
+	var buf [4]byte
+	n, err := io.ReadFull(r.reader, buf[:])
+	r.readed += int64(n)
+	if err == io.ErrUnexpectedEOF {
+		return 0, fmt.Errorf("truncated block length at compressed offset %d", r.readed)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(buf[:]), nil
+}
+
+// readBlock reads all compressed chunks of the next block
+func (r *ParallelBlockReader) readBlock() (*decodeBlock, error) {
+	limit, err := r.readLength()
+	if err != nil {
+		return nil, err
+	}
+	if limit > maxBlockSize {
+		return nil, fmt.Errorf("block of %d bytes at compressed offset %d is larger than %d", limit, r.readed, maxBlockSize)
+	}
+
+	block := &decodeBlock{
+		data: getBlockBuffer(0),
+		out:  getBlockBuffer(int(limit)),
+		done: make(chan struct{}),
+	}
+	if err = r.readChunks(block, limit); err != nil {
+		block.release()
+		return nil, err
+	}
+	return block, nil
+}
+
+// readChunks reads the compressed chunks of a block of limit decoded bytes
+func (r *ParallelBlockReader) readChunks(block *decodeBlock, limit uint32) error {
+	var decoded uint32
+	for decoded < limit {
+		offset := r.readed
+		length, err := r.readLength()
+		if err == io.EOF {
+			return fmt.Errorf("block ends after %d of %d bytes at compressed offset %d", decoded, limit, offset)
+		}
+		if err != nil {
+			return err
+		}
+		if length > maxBlockSize {
+			return fmt.Errorf("chunk of %d bytes at compressed offset %d is larger than %d", length, offset, maxBlockSize)
+		}
+
+		start := len(block.data)
+		block.data = appendChunk(block.data, int(length))
+		n, err := io.ReadFull(r.reader, block.data[start:])
+		r.readed += int64(n)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return fmt.Errorf("truncated chunk of %d bytes at compressed offset %d", length, offset)
+		}
+		if err != nil {
+			return err
+		}
+
+		deLen, err := r.decodedLen(block.data[start:])
+		if err != nil {
+			return fmt.Errorf("can't decompress chunk at compressed offset %d: %s", offset, err)
+		}
+		if deLen > int(limit-decoded) {
+			return fmt.Errorf("chunk at compressed offset %d decodes to %d bytes, only %d left in block", offset, deLen, limit-decoded)
+		}
+		block.chunks = append(block.chunks, decodeChunk{
+			offset: offset,
+			src:    [2]int{start, len(block.data)},
+			dst:    [2]int{int(decoded), int(decoded) + deLen},
+		})
+		decoded += uint32(deLen)
+	}
+	return nil
+}
+
+// appendChunk grows data by n bytes, moving it to a bigger pooled buffer if needed
+func appendChunk(data []byte, n int) []byte {
+	if len(data)+n <= cap(data) {
+		return data[:len(data)+n]
+	}
+	grown := getBlockBuffer(2*len(data) + n)[:len(data)+n]
+	copy(grown, data)
+	putBlockBuffer(data)
+	return grown
+}
+
+// release returns the buffers of the block to the pool
+func (b *decodeBlock) release() {
+	putBlockBuffer(b.data)
+	putBlockBuffer(b.out)
+	b.data, b.out = nil, nil
+}
+
+// decode decompresses all chunks of the block and releases its compressed data
+func (b *decodeBlock) decode(decompress Decompress) {
+	defer close(b.done)
+	for _, c := range b.chunks {
+		dst := b.out[c.dst[0]:c.dst[1]]
+		n, err := decompress(b.data[c.src[0]:c.src[1]], dst)
+		if err == nil && n != len(dst) {
+			err = fmt.Errorf("decoded %d of %d bytes", n, len(dst))
+		}
+		if err != nil {
+			b.err = fmt.Errorf("can't decompress chunk at compressed offset %d: %s", c.offset, err)
+			return
+		}
+	}
+	putBlockBuffer(b.data)
+	b.data = nil
+}
@@ -0,0 +1,183 @@
+package fsimage
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+
+	"github.com/lomik/hdfs-fsimage-dump/lz4"
+	"github.com/lomik/hdfs-fsimage-dump/lzo"
+)
+
+// slowDecompress decompresses snappy chunks, the ones of odd blocks slower,
+// so later blocks are often done first
+func slowDecompress(src []byte, dst []byte) (int, error) {
+	n, err := snappy_decompress(src, dst)
+	if n > 0 && dst[0]%2 == 1 {
+		time.Sleep(time.Millisecond)
+	}
+	return n, err
+}
+
+// testBlocks returns 20 blocks of one to three snappy chunks and their data
+func testBlocks() ([][]byte, [][]byte) {
+	var blocks, data [][]byte
+	for i := 0; i < 20; i++ {
+		var chunks [][]byte
+		var b []byte
+		for j := 0; j <= i%3; j++ {
+			chunk := bytes.Repeat([]byte{byte(i)}, 1000*(i+1)+j)
+			chunks = append(chunks, snappy.Encode(nil, chunk))
+			b = append(b, chunk...)
+		}
+		blocks = append(blocks, block(uint32(len(b)), chunks...))
+		data = append(data, b)
+	}
+	return blocks, data
+}
+
+func TestParallelBlockReader(t *testing.T) {
+	blocks, data := testBlocks()
+	stream := bytes.Join(blocks, nil)
+	head := bytes.Join(blocks[:7], nil)
+
+	// blocks 0-6 are good, the error of block 7 stops the reader
+	broken := func(b []byte) []byte {
+		return bytes.Join([][]byte{head, b, bytes.Join(blocks[8:], nil)}, nil)
+	}
+
+	tests := []struct {
+		name   string
+		stream []byte
+		blocks int
+		err    string
+	}{
+		{"blocks", stream, 20, ""},
+		{"empty blocks", bytes.Join([][]byte{block(0), bytes.Join(blocks[:5], nil), block(0)}, nil), 5, ""},
+		{"corrupt chunk", broken(block(6, []byte{6, 1, 2})), 7, fmt.Sprintf("can't decompress chunk at compressed offset %d", len(head)+4)},
+		{"chunk over block size", broken(block(3, snappy.Encode(nil, []byte("hello ")))), 7, "decodes to 6 bytes, only 3 left in block"},
+		{"huge block", broken(block(maxBlockSize + 1)), 7, "larger than"},
+		{"truncated chunk", stream[:len(bytes.Join(blocks[:12], nil))+100], 12, "truncated chunk"},
+		{"block ends early", append(bytes.Join(blocks[:10], nil), block(12, snappy.Encode(nil, []byte("hello ")))...), 10, "block ends after 6 of 12 bytes"},
+	}
+
+	for _, tt := range tests {
+		want := bytes.Join(data[:tt.blocks], nil)
+		for _, workers := range []int{2, 4, 8} {
+			t.Run(fmt.Sprintf("%s/%d", tt.name, workers), func(t *testing.T) {
+				r, err := NewParallelBlockReader(bytes.NewReader(tt.stream), slowDecompress, snappy.DecodedLen, workers)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := readAll(r)
+				if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+					t.Errorf("error %v, want %q", err, tt.err)
+				}
+				if !bytes.Equal(got, want) {
+					t.Errorf("read %d bytes, want the %d bytes of %d blocks", len(got), len(want), tt.blocks)
+				}
+
+				// the error stays
+				if _, err2 := r.Read(make([]byte, 1)); tt.err != "" && err2 != err {
+					t.Errorf("second read error %v, want %v", err2, err)
+				}
+			})
+		}
+	}
+}
+
+// compressedFixture is a chunk of compressor output in testdata and its data
+type compressedFixture struct {
+	chunk, data []byte
+}
+
+// readFixtures reads the chunks dir/<name>.<suffix> of ../lzo/testdata/<name>
+func readFixtures(t *testing.T, dir, suffix string, names ...string) []compressedFixture {
+	var res []compressedFixture
+	for _, name := range names {
+		chunk, err := ioutil.ReadFile(dir + "/" + name + "." + suffix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadFile("../lzo/testdata/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res = append(res, compressedFixture{chunk, data})
+	}
+	return res
+}
+
+func TestParallelBlockReaderCodecs(t *testing.T) {
+	codecs := []struct {
+		name       string
+		decompress Decompress
+		decodedLen DecodedLen
+		fixtures   []compressedFixture
+	}{
+		{"lzo1x_1", lzo_decompress, lzo.DecodedLen1X, readFixtures(t, "../lzo/testdata", "lzo1x_1", "fields.c", "sum", "random.txt")},
+		{"lzo1x_999", lzo_decompress, lzo.DecodedLen1X, readFixtures(t, "../lzo/testdata", "lzo1x_999", "fields.c", "sum", "random.txt")},
+		{"lz4", lz4_decompress, lz4.DecodedLen, readFixtures(t, "../lz4/testdata", "lz4", "fields.c")},
+		{"lz4hc", lz4_decompress, lz4.DecodedLen, readFixtures(t, "../lz4/testdata", "lz4hc", "fields.c")},
+	}
+
+	for _, c := range codecs {
+		// blocks of one chunk and of all chunks, every fixture comes twice
+		var blocks [][]byte
+		var want []byte
+		var all [][]byte
+		var allData []byte
+		for i := 0; i < 2; i++ {
+			for _, f := range c.fixtures {
+				blocks = append(blocks, block(uint32(len(f.data)), f.chunk))
+				want = append(want, f.data...)
+				all = append(all, f.chunk)
+				allData = append(allData, f.data...)
+			}
+		}
+		blocks = append(blocks, block(uint32(len(allData)), all...))
+		want = append(want, allData...)
+		stream := bytes.Join(blocks, nil)
+
+		// the first two blocks are read, the third one is garbage
+		f := c.fixtures[0]
+		head := bytes.Join(blocks[:2], nil)
+		headData := append(append([]byte(nil), f.data...), c.fixtures[1%len(c.fixtures)].data...)
+		corrupt := bytes.Repeat([]byte{0xff}, 16)
+
+		tests := []struct {
+			name   string
+			stream []byte
+			want   []byte
+			err    string
+		}{
+			{"blocks", stream, want, ""},
+			{"corrupt chunk", append(append([]byte(nil), head...), block(uint32(len(f.data)), corrupt)...), headData, "can't decompress chunk"},
+			{"chunk over block size", block(uint32(len(f.data)-1), f.chunk), nil, fmt.Sprintf("decodes to %d bytes, only %d left in block", len(f.data), len(f.data)-1)},
+			{"block ends early", block(uint32(len(f.data)+1), f.chunk), nil, "block ends after"},
+		}
+
+		for _, tt := range tests {
+			for _, workers := range []int{2, 4, 8} {
+				t.Run(fmt.Sprintf("%s/%s/%d", c.name, tt.name, workers), func(t *testing.T) {
+					r, err := NewParallelBlockReader(bytes.NewReader(tt.stream), c.decompress, c.decodedLen, workers)
+					if err != nil {
+						t.Fatal(err)
+					}
+					got, err := readAll(r)
+					if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+						t.Errorf("error %v, want %q", err, tt.err)
+					}
+					if !bytes.Equal(got, tt.want) {
+						t.Errorf("read %d bytes, want %d", len(got), len(tt.want))
+					}
+				})
+			}
+		}
+	}
+}
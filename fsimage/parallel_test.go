@@ -0,0 +1,298 @@
+package fsimage
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/lomik/hdfs-fsimage-dump/pb/hadoop_hdfs_fsimage"
+)
+
+// newShuffledTree returns an image of a tree of several INodeBatchSize inodes where
+// some inodes come before their parent directories, and the ids in INODE order
+// without the root
+func newShuffledTree(t testing.TB) (*testImage, []uint64) {
+	root := testDir(RootInodeID, "")
+	inodes := []*pb.INodeSection_INode{root}
+	children := make(map[uint64][]uint64)
+
+	id := uint64(RootInodeID)
+	parents := []uint64{RootInodeID}
+	for len(inodes) < 3*INodeBatchSize {
+		id++
+		parent := parents[len(inodes)%len(parents)]
+		if id%7 == 0 {
+			inodes = append(inodes, testDir(id, "d"+strconv.FormatUint(id, 10)))
+			parents = append(parents, id)
+		} else {
+			inodes = append(inodes, testFile(id, "f"+strconv.FormatUint(id, 10), id))
+		}
+		children[parent] = append(children[parent], id)
+	}
+
+	// local swaps and one file moved before all directories
+	rnd := rand.New(rand.NewSource(1))
+	for i := range inodes {
+		if j := i + rnd.Intn(40); j < len(inodes) {
+			inodes[i], inodes[j] = inodes[j], inodes[i]
+		}
+	}
+	last := inodes[len(inodes)-1]
+	copy(inodes[1:], inodes[:len(inodes)-1])
+	inodes[0] = last
+
+	var order []uint64
+	for _, inode := range inodes {
+		if inode.GetId() != RootInodeID {
+			order = append(order, inode.GetId())
+		}
+	}
+
+	b := newTestImage()
+	b.addTree(t, inodes, children)
+	return b, order
+}
+
+func processIds(t *testing.T, img *Image, opt ParallelOptions) []uint64 {
+	ns, err := img.LoadNamespace(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	err = img.ProcessRecords(ns, opt, func(records []Record, out *bytes.Buffer) error {
+		for i := range records {
+			fmt.Fprintln(out, records[i].Id)
+		}
+		return nil
+	}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []uint64
+	for _, line := range strings.Fields(out.String()) {
+		id, err := strconv.ParseUint(line, 10, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func equalIds(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestProcessRecordsOrder(t *testing.T) {
+	b, order := newShuffledTree(t)
+	img := b.open(t)
+
+	for _, workers := range []int{1, 3, 8} {
+		ids := processIds(t, img, ParallelOptions{Workers: workers})
+		if !equalIds(ids, order) {
+			t.Errorf("workers %d: records are not in INODE section order", workers)
+		}
+
+		ids = processIds(t, img, ParallelOptions{Workers: workers, Unordered: true})
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		sorted := append([]uint64(nil), order...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		if !equalIds(ids, sorted) {
+			t.Errorf("workers %d: unordered records differ from INODE section", workers)
+		}
+	}
+}
+
+func TestRecordReaderOrder(t *testing.T) {
+	b, order := newShuffledTree(t)
+	img := b.open(t)
+
+	ns, err := img.LoadNamespace(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := img.NewRecordReader(ns, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []uint64
+	for {
+		rec, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rec.Type == pb.INodeSection_INode_FILE && rec.Path != fmt.Sprintf("%s/f%d", pathOf(t, ns, rec.Id), rec.Id) {
+			t.Errorf("path of %d is %s", rec.Id, rec.Path)
+		}
+		ids = append(ids, rec.Id)
+	}
+	if !equalIds(ids, order) {
+		t.Error("records are not in INODE section order")
+	}
+}
+
+// pathOf returns the directory path of inode id from the tree
+func pathOf(t *testing.T, ns *Namespace, id uint64) string {
+	ps := ns.Tree.GetParents(id)
+	if len(ps) != 1 {
+		t.Fatalf("inode %d has %d parents", id, len(ps))
+	}
+	dir, ok := getPathsReq(ps[0].Parent, 0, ns.Tree, false)
+	if !ok {
+		t.Fatalf("no path of %d", ps[0].Parent)
+	}
+	return dir
+}
+
+func TestProcessRecordsError(t *testing.T) {
+	b, order := newShuffledTree(t)
+	img := b.open(t)
+	failAt := order[len(order)/2]
+
+	for _, workers := range []int{1, 8} {
+		ns, err := img.LoadNamespace(false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = img.ProcessRecords(ns, ParallelOptions{Workers: workers}, func(records []Record, out *bytes.Buffer) error {
+			if records[0].Id == failAt {
+				return fmt.Errorf("fail at %d", failAt)
+			}
+			return nil
+		}, ioutil.Discard)
+		if err == nil || err.Error() != fmt.Sprintf("fail at %d", failAt) {
+			t.Errorf("workers %d: error %v", workers, err)
+		}
+	}
+}
+
+func TestProcessRecordsRoot(t *testing.T) {
+	root := testDir(RootInodeID, "")
+	root.Directory.NsQuota = proto.Uint64(1000)
+	// the file and the root are held back till their parent is read
+	b := newTestImage()
+	b.addTree(t, []*pb.INodeSection_INode{testFile(16387, "f", 1), root, testDir(16386, "a")},
+		map[uint64][]uint64{RootInodeID: {16386}, 16386: {16387}})
+	img := b.open(t)
+
+	for _, tt := range []struct {
+		opt   ParallelOptions
+		paths string
+	}{
+		{ParallelOptions{Workers: 1}, "/a/f /a"},
+		{ParallelOptions{Workers: 1, Root: true}, "/a/f / /a"},
+		{ParallelOptions{Workers: 4, Root: true}, "/a/f / /a"},
+		{ParallelOptions{Workers: 4, Root: true, Unordered: true}, "/ /a /a/f"},
+	} {
+		ns, err := img.LoadNamespace(false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		err = img.ProcessRecords(ns, tt.opt, func(records []Record, out *bytes.Buffer) error {
+			for _, rec := range records {
+				if rec.Path == "/" && (rec.Id != RootInodeID || rec.NsQuota != 1000 || rec.Type != pb.INodeSection_INode_DIRECTORY) {
+					t.Errorf("root record %+v", rec)
+				}
+				fmt.Fprint(out, rec.Path, " ")
+			}
+			return nil
+		}, &out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.TrimSpace(out.String()); got != tt.paths {
+			t.Errorf("%+v: %s, want %s", tt.opt, got, tt.paths)
+		}
+	}
+}
+
+func TestProcessRecordsSymlinkInSnapshot(t *testing.T) {
+	symlink := func(id uint64, name string, target string) *pb.INodeSection_INode {
+		return &pb.INodeSection_INode{
+			Type: pb.INodeSection_INode_SYMLINK.Enum(),
+			Id:   proto.Uint64(id),
+			Name: []byte(name),
+			Symlink: &pb.INodeSection_INodeSymlink{
+				Permission:       testPermission(0777),
+				Target:           []byte(target),
+				ModificationTime: proto.Uint64(1505725539089),
+				AccessTime:       proto.Uint64(1505405189045),
+			},
+		}
+	}
+
+	// /a/l exists and comes before its directory, /a/old was deleted after the snapshot s0 of /a
+	b := newTestImage()
+	b.addTree(t, []*pb.INodeSection_INode{testDir(RootInodeID, ""), symlink(16387, "l", "/a/f"), testDir(16386, "a"), symlink(16388, "old", "../b")},
+		map[uint64][]uint64{RootInodeID: {16386}, 16386: {16387}})
+	b.add(t, "SNAPSHOT",
+		&pb.SnapshotSection{SnapshotCounter: proto.Uint32(2), SnapshottableDir: []uint64{16386}, NumSnapshots: proto.Uint32(1)},
+		&pb.SnapshotSection_Snapshot{SnapshotId: proto.Uint32(1), Root: testDir(16386, "s0")})
+	b.add(t, "SNAPSHOT_DIFF",
+		&pb.SnapshotDiffSection_DiffEntry{
+			Type: pb.SnapshotDiffSection_DiffEntry_DIRECTORYDIFF.Enum(), InodeId: proto.Uint64(16386), NumOfDiff: proto.Uint32(1),
+		},
+		&pb.SnapshotDiffSection_DirectoryDiff{
+			SnapshotId: proto.Uint32(1), ChildrenSize: proto.Uint32(2), IsSnapshotRoot: proto.Bool(true),
+			DeletedINode: []uint64{16388},
+		})
+	img := b.open(t)
+
+	want := []Record{
+		{Path: "/a/l", Target: "/a/f", AccessTime: 1505405189045},
+		{Path: "/a/.snapshot/s0/old", Target: "../b", AccessTime: 1505405189045, SnapId: 1},
+	}
+	for _, workers := range []int{1, 4} {
+		ns, err := img.LoadNamespace(false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []Record
+		err = img.ProcessRecords(ns, ParallelOptions{Workers: workers}, func(records []Record, out *bytes.Buffer) error {
+			for _, rec := range records {
+				if rec.Type == pb.INodeSection_INode_SYMLINK {
+					got = append(got, rec)
+				}
+			}
+			return nil
+		}, ioutil.Discard)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(got) != len(want) {
+			t.Fatalf("workers %d: %d symlinks, want %d", workers, len(got), len(want))
+		}
+		for i, rec := range got {
+			if rec.Path != want[i].Path || rec.SnapId != want[i].SnapId || rec.Target != want[i].Target ||
+				rec.Permission != "lrwxrwxrwx" || rec.User != "hdfs" || rec.Group != "supergroup" ||
+				rec.ModificationTime != 1505725539089 || rec.AccessTime != want[i].AccessTime {
+				t.Errorf("workers %d: symlink %s %d %s %s %s:%s %d %d", workers, rec.Path, rec.SnapId, rec.Target,
+					rec.Permission, rec.User, rec.Group, rec.ModificationTime, rec.AccessTime)
+			}
+		}
+	}
+}
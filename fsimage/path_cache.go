@@ -0,0 +1,41 @@
+package fsimage
+
+// DefaultPathCacheSize is the number of directory paths kept by NodeTree.
+const DefaultPathCacheSize = 1 << 20
+
+type pathKey struct {
+	key  uint64
+	snap uint32
+}
+
+// pathCache keeps resolved directory paths. Entries are kept in two
+// generations of size/2, the older one is dropped when the newer one is full,
+// so recently used directories stay in the cache.
+type pathCache struct {
+	size int
+	cur  map[pathKey]string
+	prev map[pathKey]string
+}
+
+func (c *pathCache) get(k pathKey) (string, bool) {
+	if p, ok := c.cur[k]; ok {
+		return p, true
+	}
+	if p, ok := c.prev[k]; ok {
+		delete(c.prev, k)
+		c.put(k, p)
+		return p, true
+	}
+	return "", false
+}
+
+func (c *pathCache) put(k pathKey, path string) {
+	if c.size <= 0 {
+		return
+	}
+	if c.cur == nil || len(c.cur) >= (c.size+1)/2 {
+		c.prev = c.cur
+		c.cur = make(map[pathKey]string)
+	}
+	c.cur[k] = path
+}
@@ -0,0 +1,84 @@
+package fsimage
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestPathCache(t *testing.T) {
+	c := pathCache{size: 4}
+	for i := uint64(0); i < 4; i++ {
+		c.put(pathKey{key: i}, strconv.FormatUint(i, 10))
+	}
+	// 0 and 1 are dropped with the older generation, 2 is used and kept
+	if p, ok := c.get(pathKey{key: 2}); !ok || p != "2" {
+		t.Errorf("get 2 = %q %v", p, ok)
+	}
+	c.put(pathKey{key: 4}, "4")
+	c.put(pathKey{key: 5}, "5")
+
+	for i, want := range []bool{false, false, true, false, true, true} {
+		if _, ok := c.get(pathKey{key: uint64(i)}); ok != want {
+			t.Errorf("get %d = %v, want %v", i, ok, want)
+		}
+	}
+	if _, ok := c.get(pathKey{key: 5, snap: 1}); ok {
+		t.Error("path of another snapshot")
+	}
+
+	off := pathCache{}
+	off.put(pathKey{key: 1}, "1")
+	if _, ok := off.get(pathKey{key: 1}); ok {
+		t.Error("disabled cache keeps paths")
+	}
+}
+
+// newDeepTree returns a tree of depth directories in a chain with files files
+// in each of the width deepest directories, and the file keys
+func newDeepTree(depth, width, files int) (*NodeTree, []uint64) {
+	tree := NewNodeTree()
+	key := uint64(RootInodeID)
+	parent := key
+	for i := 0; i < depth; i++ {
+		key++
+		tree.SetParentName(key, 0, parent, []byte("dir"+strconv.Itoa(i)))
+		parent = key
+	}
+
+	var keys []uint64
+	for i := 0; i < width; i++ {
+		key++
+		dir := key
+		tree.SetParentName(dir, 0, parent, []byte("leaf"+strconv.Itoa(i)))
+		for j := 0; j < files; j++ {
+			key++
+			tree.SetParent(key, 0, dir)
+			keys = append(keys, key)
+		}
+	}
+	tree.nameAllSnapshots()
+	return tree, keys
+}
+
+func BenchmarkGetPaths(b *testing.B) {
+	for _, bc := range []struct {
+		name  string
+		cache int
+	}{
+		{"cache", DefaultPathCacheSize},
+		{"no cache", 0},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			tree, keys := newDeepTree(64, 16, 64)
+			tree.SetPathCacheSize(bc.cache)
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				if _, err := tree.GetPaths(keys[i%len(keys)], "file", false, false); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
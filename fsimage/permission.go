@@ -0,0 +1,24 @@
+package fsimage
+
+import (
+	"fmt"
+)
+
+var (
+	permMap = []string{
+		"---",
+		"--x",
+		"-w-",
+		"-wx",
+		"r--",
+		"r-x",
+		"rw-",
+		"rwx",
+	}
+)
+
+// PermissionString formats the mode bits of an inode permission as "drwxr-xr-x".
+func PermissionString(typ byte, permission uint64) string {
+	perm := permission % (1 << 16)
+	return fmt.Sprintf("%c%s%s%s", typ, permMap[(perm>>6)%8], permMap[(perm>>3)%8], permMap[(perm)%8])
+}
@@ -0,0 +1,144 @@
+package fsimage
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	pb "github.com/lomik/hdfs-fsimage-dump/pb/hadoop_hdfs_fsimage"
+)
+
+// ContentSummary is the usage of a directory with everything below it, the
+// numbers of `hdfs dfs -count -q`. Quotas are -1 if not set.
+type ContentSummary struct {
+	Path           string
+	NsQuota        int64
+	DsQuota        int64
+	DirectoryCount uint64
+	FileCount      uint64
+	Length         uint64
+	// SpaceConsumed is the raw space of the files including replication
+	SpaceConsumed uint64
+}
+
+// HasQuota reports if a namespace or a space quota is set.
+func (s *ContentSummary) HasQuota() bool {
+	return s.NsQuota >= 0 || s.DsQuota >= 0
+}
+
+// NsConsumed is the number of directories and files counted against the namespace quota.
+func (s *ContentSummary) NsConsumed() uint64 {
+	return s.DirectoryCount + s.FileCount
+}
+
+// OverShare reports if the consumed namespace or space reaches share of its quota.
+func (s *ContentSummary) OverShare(share float64) bool {
+	if s.NsQuota >= 0 && float64(s.NsConsumed()) >= share*float64(s.NsQuota) {
+		return true
+	}
+	return s.DsQuota >= 0 && float64(s.SpaceConsumed) >= share*float64(s.DsQuota)
+}
+
+// ContentCounter sums up current records per directory. Add may be called
+// from several goroutines and in any order of records. The quotas of the root
+// are only known from its record, see ParallelOptions.Root.
+type ContentCounter struct {
+	mu   sync.Mutex
+	dirs map[string]*ContentSummary
+	// root is set if the record of the root was added
+	root bool
+}
+
+func NewContentCounter() *ContentCounter {
+	return &ContentCounter{dirs: make(map[string]*ContentSummary)}
+}
+
+// dir returns the summary of path p, the lock must be held
+func (c *ContentCounter) dir(p string) *ContentSummary {
+	s, ok := c.dirs[p]
+	if !ok {
+		s = &ContentSummary{Path: p, NsQuota: -1, DsQuota: -1}
+		c.dirs[p] = s
+	}
+	return s
+}
+
+// Add counts a record. Snapshot records are skipped like in `hdfs dfs -count`.
+func (c *ContentCounter) Add(rec *Record) {
+	if rec.SnapId != 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch rec.Type {
+	case pb.INodeSection_INode_DIRECTORY:
+		s := c.dir(rec.Path)
+		s.NsQuota = rec.NsQuota
+		s.DsQuota = rec.DsQuota
+		s.DirectoryCount++
+		if rec.Path == "/" {
+			c.root = true
+		}
+	case pb.INodeSection_INode_FILE, pb.INodeSection_INode_SYMLINK:
+		s := c.dir(path.Dir(rec.Path))
+		s.FileCount++
+		s.Length += rec.FileSize
+		s.SpaceConsumed += rec.FileSize * uint64(rec.Replication)
+	}
+}
+
+// Summaries adds the counts of every directory to its ancestors and returns
+// all directories sorted by path. Call it after all records are added.
+func (c *ContentCounter) Summaries() []*ContentSummary {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// the root counts itself like hdfs dfs -count, also without its record
+	if !c.root {
+		c.dir("/").DirectoryCount++
+	}
+	// directories without records still sum up their children
+	for p := range c.dirs {
+		for p != "/" {
+			p = path.Dir(p)
+			if _, ok := c.dirs[p]; ok {
+				break
+			}
+			c.dir(p)
+		}
+	}
+
+	dirs := make([]*ContentSummary, 0, len(c.dirs))
+	for _, s := range c.dirs {
+		dirs = append(dirs, s)
+	}
+	// children before parents
+	sort.Slice(dirs, func(i, j int) bool {
+		return depth(dirs[i].Path) > depth(dirs[j].Path)
+	})
+	for _, s := range dirs {
+		if s.Path == "/" {
+			continue
+		}
+		parent := c.dirs[path.Dir(s.Path)]
+		parent.DirectoryCount += s.DirectoryCount
+		parent.FileCount += s.FileCount
+		parent.Length += s.Length
+		parent.SpaceConsumed += s.SpaceConsumed
+	}
+
+	sort.Slice(dirs, func(i, j int) bool {
+		return dirs[i].Path < dirs[j].Path
+	})
+	return dirs
+}
+
+// depth is the number of elements of an absolute path, 0 for the root
+func depth(p string) int {
+	if p == "/" {
+		return 0
+	}
+	return strings.Count(p, "/")
+}
@@ -0,0 +1,79 @@
+package fsimage
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	pb "github.com/lomik/hdfs-fsimage-dump/pb/hadoop_hdfs_fsimage"
+)
+
+func TestContentCounter(t *testing.T) {
+	dir := pb.INodeSection_INode_DIRECTORY
+	file := pb.INodeSection_INode_FILE
+	records := []Record{
+		{Type: dir, Path: "/a", NsQuota: 10, DsQuota: 1000},
+		{Type: dir, Path: "/a/b", NsQuota: -1, DsQuota: -1},
+		{Type: file, Path: "/a/f1", FileSize: 100, Replication: 3},
+		{Type: file, Path: "/a/b/f2", FileSize: 10, Replication: 2},
+		{Type: pb.INodeSection_INode_SYMLINK, Path: "/a/b/l"},
+		{Type: file, Path: "/x", FileSize: 5, Replication: 1},
+		{Type: file, Path: "/a/.snapshot/s1/f1", FileSize: 100, Replication: 3, SnapId: 1},
+		// the parent of /c/d has no record
+		{Type: dir, Path: "/c/d", NsQuota: -1, DsQuota: 50},
+	}
+	want := []ContentSummary{
+		{"/", -1, -1, 4, 4, 115, 325},
+		{"/a", 10, 1000, 2, 3, 110, 320},
+		{"/a/b", -1, -1, 1, 2, 10, 20},
+		{"/c", -1, -1, 1, 0, 0, 0},
+		{"/c/d", -1, 50, 1, 0, 0, 0},
+	}
+
+	for _, root := range []bool{false, true} {
+		recs := append([]Record(nil), records...)
+		if root {
+			recs = append(recs, Record{Type: dir, Path: "/", NsQuota: math.MaxInt64, DsQuota: -1})
+			want[0].NsQuota = math.MaxInt64
+		}
+		rand.New(rand.NewSource(1)).Shuffle(len(recs), func(i, j int) {
+			recs[i], recs[j] = recs[j], recs[i]
+		})
+
+		c := NewContentCounter()
+		for i := range recs {
+			c.Add(&recs[i])
+		}
+		got := c.Summaries()
+		if len(got) != len(want) {
+			t.Fatalf("root %v: %d summaries, want %d", root, len(got), len(want))
+		}
+		for i := range want {
+			if *got[i] != want[i] {
+				t.Errorf("root %v: %+v, want %+v", root, *got[i], want[i])
+			}
+		}
+	}
+}
+
+func TestContentSummary(t *testing.T) {
+	tests := []struct {
+		s        ContentSummary
+		hasQuota bool
+		over     bool
+	}{
+		{ContentSummary{NsQuota: -1, DsQuota: -1, DirectoryCount: 5}, false, false},
+		{ContentSummary{NsQuota: 10, DsQuota: -1, DirectoryCount: 1, FileCount: 8}, true, true},
+		{ContentSummary{NsQuota: 10, DsQuota: -1, DirectoryCount: 1, FileCount: 7}, true, false},
+		{ContentSummary{NsQuota: -1, DsQuota: 1000, SpaceConsumed: 900}, true, true},
+		{ContentSummary{NsQuota: math.MaxInt64, DsQuota: 1000, SpaceConsumed: 899}, true, false},
+	}
+	for _, tt := range tests {
+		if got := tt.s.HasQuota(); got != tt.hasQuota {
+			t.Errorf("%+v: HasQuota %v", tt.s, got)
+		}
+		if got := tt.s.OverShare(0.9); got != tt.over {
+			t.Errorf("%+v: OverShare %v", tt.s, got)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package fsimage
+
+import (
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/lomik/hdfs-fsimage-dump/pb/hadoop_hdfs_fsimage"
+)
+
+// Record is one resolved path of an inode.
+type Record struct {
+	Id                 uint64
+	Type               pb.INodeSection_INode_Type
+	Path               string
+	SnapId             uint32
+	Permission         string
+	User               string
+	Group              string
+	ModificationTime   uint64
+	AccessTime         uint64
+	Replication        uint32
+	PreferredBlockSize uint64
+	BlocksCount        int
+	FileSize           uint64
+	// UnderConstruction is set for a file open for write by LeaseHolder on ClientMachine
+	UnderConstruction bool
+	LeaseHolder       string
+	ClientMachine     string
+	// NsQuota and DsQuota of a directory, -1 if not set
+	NsQuota int64
+	DsQuota int64
+	// Target of a symlink
+	Target string
+	// Acl of an inode with the ACL feature, its Permission ends with "+"
+	Acl []AclEntry
+	// XAttrs of an inode with the xattr feature
+	XAttrs []XAttr
+	// EncryptionZone is the path of the encryption zone of the inode and
+	// KeyName its key, KeyVersionName is the key version of an encrypted file
+	EncryptionZone string
+	KeyName        string
+	KeyVersionName string
+	// INode is the decoded inode, valid until the next record is produced
+	INode *pb.INodeSection_INode
+}
+
+// RecordReader yields one Record per path of every file, directory and symlink in the INODE section.
+// Records come in the order of the INODE section.
+type RecordReader struct {
+	pass    *inodePass
+	ns      *Namespace
+	inode   *pb.INodeSection_INode
+	records []Record
+	next    int
+}
+
+// NewRecordReader returns a RecordReader resolving paths through ns.
+func (img *Image) NewRecordReader(ns *Namespace, snapCleanup bool) (*RecordReader, error) {
+	pass, err := img.newINodePass(ns, snapCleanup, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RecordReader{
+		pass:  pass,
+		ns:    ns,
+		inode: &pb.INodeSection_INode{},
+	}, nil
+}
+
+// Next returns the next record or io.EOF. The returned record is reused by the following call.
+func (r *RecordReader) Next() (*Record, error) {
+	for r.next >= len(r.records) {
+		frame, paths, err := r.pass.next()
+		if err != nil {
+			return nil, err
+		}
+		if err = proto.Unmarshal(frame, r.inode); err != nil {
+			if err = r.ns.handle(decodeError(frame, err), "INODE"); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		r.records = r.ns.appendRecords(r.records[:0], r.inode, paths)
+		r.next = 0
+	}
+
+	rec := &r.records[r.next]
+	r.next++
+	return rec, nil
+}
+
+// Close releases resources of a reader which is not read till io.EOF.
+func (r *RecordReader) Close() {
+	r.pass.close()
+}
+
+// AppendRecords appends records for every resolved path of inode to dst.
+// Inodes other than files, directories and symlinks produce no records.
+func (ns *Namespace) AppendRecords(dst []Record, inode *pb.INodeSection_INode, snapCleanup bool) ([]Record, error) {
+	paths, err := ns.resolve(inode.GetType(), inode.GetId(), inode.GetName(), snapCleanup, false)
+	if err != nil {
+		return dst, handleNodeError(err, "INODE", nil)
+	}
+	return ns.appendRecords(dst, inode, paths), nil
+}
+
+func (ns *Namespace) appendRecords(dst []Record, inode *pb.INodeSection_INode, paths []Path) []Record {
+	if len(paths) == 0 {
+		return dst
+	}
+
+	var rec Record
+
+	if inode.File != nil {
+		blocks := inode.File.GetBlocks()
+		size := uint64(0)
+		for i := 0; i < len(blocks); i++ {
+			size += blocks[i].GetNumBytes()
+		}
+		rec = Record{
+			Type:               pb.INodeSection_INode_FILE,
+			Permission:         PermissionString('-', inode.File.GetPermission()),
+			User:               ns.User(inode.File.GetPermission()),
+			Group:              ns.Group(inode.File.GetPermission()),
+			ModificationTime:   inode.File.GetModificationTime(),
+			AccessTime:         inode.File.GetAccessTime(),
+			Replication:        inode.File.GetReplication(),
+			PreferredBlockSize: inode.File.GetPreferredBlockSize(),
+			BlocksCount:        len(blocks),
+			FileSize:           size,
+			Acl:                ns.Acl(inode.File.GetPermission(), inode.File.GetAcl()),
+			XAttrs:             ns.XAttrs(inode.File.GetXAttrs()),
+		}
+		rec.KeyVersionName = KeyVersionName(rec.XAttrs)
+		if uc := inode.File.GetFileUC(); uc != nil {
+			rec.UnderConstruction = true
+			rec.LeaseHolder = uc.GetClientName()
+			rec.ClientMachine = uc.GetClientMachine()
+		}
+	} else if inode.Directory != nil {
+		rec = Record{
+			Type:             pb.INodeSection_INode_DIRECTORY,
+			Permission:       PermissionString('d', inode.Directory.GetPermission()),
+			User:             ns.User(inode.Directory.GetPermission()),
+			Group:            ns.Group(inode.Directory.GetPermission()),
+			ModificationTime: inode.Directory.GetModificationTime(),
+			NsQuota:          int64(inode.Directory.GetNsQuota()),
+			DsQuota:          int64(inode.Directory.GetDsQuota()),
+			Acl:              ns.Acl(inode.Directory.GetPermission(), inode.Directory.GetAcl()),
+			XAttrs:           ns.XAttrs(inode.Directory.GetXAttrs()),
+		}
+	} else if inode.Symlink != nil {
+		rec = Record{
+			Type:             pb.INodeSection_INode_SYMLINK,
+			Permission:       PermissionString('l', inode.Symlink.GetPermission()),
+			User:             ns.User(inode.Symlink.GetPermission()),
+			Group:            ns.Group(inode.Symlink.GetPermission()),
+			ModificationTime: inode.Symlink.GetModificationTime(),
+			AccessTime:       inode.Symlink.GetAccessTime(),
+			Target:           string(inode.Symlink.GetTarget()),
+		}
+	} else {
+		return dst
+	}
+	rec.Id = inode.GetId()
+	rec.INode = inode
+	if rec.Acl != nil {
+		rec.Permission += "+"
+	}
+
+	for _, path := range paths {
+		rec.Path = path.Path
+		rec.SnapId = path.SnapId
+		rec.EncryptionZone, rec.KeyName = "", ""
+		if path.Zone != nil {
+			rec.EncryptionZone = path.Zone.Path
+			rec.KeyName = path.Zone.KeyName
+		}
+		dst = append(dst, rec)
+	}
+	return dst
+}
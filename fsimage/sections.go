@@ -0,0 +1,402 @@
+package fsimage
+
+import (
+	"io"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/lomik/hdfs-fsimage-dump/pb/hadoop_hdfs_fsimage"
+)
+
+type snapshotRoot struct {
+	Id     uint64
+	SnapId uint32
+	Name   []byte
+}
+
+// ReadSnapshots places snapshot roots from the SNAPSHOT section into tree.
+// Names of snapshotted directories must be already set.
+func (img *Image) ReadSnapshots(tree *NodeTree, snapReplace bool) error {
+	roots, err := img.readSnapshotRoots()
+	if err != nil {
+		return err
+	}
+	tree.addSnapshots(roots, snapReplace)
+	tree.nameAllSnapshots()
+	return nil
+}
+
+func (img *Image) readSnapshotRoots() ([]snapshotRoot, error) {
+
+	fr, err := img.NewSectionReader("SNAPSHOT")
+	if err != nil {
+		return nil, err
+	}
+
+	snapshotSection := &pb.SnapshotSection{}
+	if err = fr.ReadMessage(snapshotSection); err != nil {
+		return nil, err
+	}
+
+	var roots []snapshotRoot
+
+	snapshot := &pb.SnapshotSection_Snapshot{}
+
+	for {
+		if err = fr.ReadMessage(snapshot); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+
+		if snapshot.GetRoot().GetDirectory() != nil {
+			roots = append(roots, snapshotRoot{
+				Id:     snapshot.GetRoot().GetId(),
+				SnapId: snapshot.GetSnapshotId(),
+				Name:   snapshot.GetRoot().GetName(),
+			})
+		}
+	}
+
+	fr = nil
+	return roots, nil
+}
+
+type snapshotDiffEntry struct {
+	Parent uint64
+	Key    uint64
+	Ref    uint32
+	IsRef  bool
+	SnapId uint32
+	Name   []byte
+}
+
+// ReadSnapshotDiff adds inodes deleted after a snapshot from the SNAPSHOT_DIFF section into tree.
+func (img *Image) ReadSnapshotDiff(tree *NodeTree, inodeReference *NodeRefTree) error {
+	diff, err := img.readSnapshotDiff()
+	if err != nil {
+		return err
+	}
+	return applySnapshotDiff(tree, inodeReference, diff, nil)
+}
+
+func applySnapshotDiff(tree *NodeTree, inodeReference *NodeRefTree, diff []snapshotDiffEntry, onError ErrorHandler) error {
+	for _, d := range diff {
+		key := d.Key
+		name := d.Name
+		if d.IsRef {
+			key = inodeReference.GetRefId(d.Ref)
+			name = inodeReference.GetRefName(d.Ref)
+		}
+		tree.SetParent(key, d.SnapId, d.Parent)
+		if len(name) > 0 {
+			if err := tree.SetName(key, d.SnapId, name); err != nil {
+				if err = handleNodeError(err, "SNAPSHOT_DIFF", onError); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (img *Image) readSnapshotDiff() ([]snapshotDiffEntry, error) {
+
+	fr, err := img.NewSectionReader("SNAPSHOT_DIFF")
+	if err != nil {
+		return nil, err
+	}
+
+	var diff []snapshotDiffEntry
+
+	snapshotDiff := &pb.SnapshotDiffSection_DiffEntry{}
+	snapshotDirDiff := &pb.SnapshotDiffSection_DirectoryDiff{}
+	snapshotFileDiff := &pb.SnapshotDiffSection_FileDiff{}
+	snapshotCreatedListEntry := &pb.SnapshotDiffSection_CreatedListEntry{}
+
+	for {
+		body, err := fr.ReadFrame()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+
+		if err = proto.Unmarshal(body, snapshotDiff); err != nil {
+			return nil, err
+		}
+
+		for i := 0; i < int(snapshotDiff.GetNumOfDiff()); i++ {
+
+			// read and skip FILEDIFF entry
+			if snapshotDiff.GetType() == pb.SnapshotDiffSection_DiffEntry_FILEDIFF {
+				if err = fr.ReadMessage(snapshotFileDiff); err != nil {
+					return nil, err
+				}
+				continue
+			}
+
+			body, err := fr.ReadFrame()
+			if err != nil {
+				if err == io.EOF {
+					break
+				}
+				return nil, err
+			}
+
+			if err = proto.Unmarshal(body, snapshotDirDiff); err != nil {
+				return nil, err
+			}
+			for _, deletedInodeRef := range snapshotDirDiff.GetDeletedINodeRef() {
+				diff = append(diff, snapshotDiffEntry{
+					Parent: snapshotDiff.GetInodeId(),
+					Ref:    deletedInodeRef,
+					IsRef:  true,
+					SnapId: snapshotDirDiff.GetSnapshotId(),
+				})
+			}
+
+			for _, deletedInode := range snapshotDirDiff.GetDeletedINode() {
+				diff = append(diff, snapshotDiffEntry{
+					Parent: snapshotDiff.GetInodeId(),
+					Key:    deletedInode,
+					SnapId: snapshotDirDiff.GetSnapshotId(),
+					Name:   snapshotDirDiff.GetName(),
+				})
+			}
+
+			// read and skip CreatedList
+			for j := 0; j < int(snapshotDirDiff.GetCreatedListSize()); j++ {
+				if err = fr.ReadMessage(snapshotCreatedListEntry); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	fr = nil
+	return diff, nil
+}
+
+type dirName struct {
+	Id   uint64
+	Name []byte
+}
+
+// ReadDirectoryNames sets names of all directories from the INODE section in tree.
+func (img *Image) ReadDirectoryNames(tree *NodeTree) error {
+	names, err := img.readDirectoryNames()
+	if err != nil {
+		return err
+	}
+	return applyDirectoryNames(tree, names)
+}
+
+func applyDirectoryNames(tree *NodeTree, names []dirName) error {
+	for _, n := range names {
+		if err := tree.SetName(n.Id, 0, n.Name); err != nil {
+			return handleNodeError(err, "INODE", nil)
+		}
+	}
+	return nil
+}
+
+func (img *Image) readDirectoryNames() ([]dirName, error) {
+
+	fr, err := img.NewSectionReader("INODE")
+	if err != nil {
+		return nil, err
+	}
+
+	inodeSection := &pb.INodeSection{}
+	if err = fr.ReadMessage(inodeSection); err != nil {
+		return nil, err
+	}
+
+	var names []dirName
+
+	inode := &pb.INodeSection_INode{}
+	for {
+		body, err := fr.ReadFrame()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+
+		// skip files without parse
+		if len(body) >= 2 && body[0] == 0x8 && body[1] == 0x1 {
+			continue
+		}
+		if err = proto.Unmarshal(body, inode); err != nil {
+			return nil, err
+		}
+		if inode.GetDirectory() != nil {
+			names = append(names, dirName{Id: inode.GetId(), Name: inode.GetName()})
+		}
+	}
+
+	fr = nil
+	return names, nil
+}
+
+type refChild struct {
+	Parent uint64
+	Ref    uint32
+}
+
+// ReadTree fills parent links of tree from the INODE_DIR section.
+func (img *Image) ReadTree(tree *NodeTree, inodeReference *NodeRefTree) error {
+	refChildren, err := img.readTree(tree)
+	if err != nil {
+		return err
+	}
+	applyRefChildren(tree, inodeReference, refChildren)
+	return nil
+}
+
+func applyRefChildren(tree *NodeTree, inodeReference *NodeRefTree, refChildren []refChild) {
+	for _, c := range refChildren {
+		tree.SetParent(inodeReference.GetRefId(c.Ref), inodeReference.GetRefSnapId(c.Ref), c.Parent)
+	}
+}
+
+// readTree sets parents of plain children and returns reference children to be resolved later
+func (img *Image) readTree(tree *NodeTree) ([]refChild, error) {
+
+	fr, err := img.NewSectionReader("INODE_DIR")
+	if err != nil {
+		return nil, err
+	}
+
+	var refs []refChild
+
+	dirEntry := &pb.INodeDirectorySection_DirEntry{}
+	for {
+		if err = fr.ReadMessage(dirEntry); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+
+		children := dirEntry.GetChildren()
+		for j := 0; j < len(children); j++ {
+			tree.SetParent(children[j], 0, dirEntry.GetParent())
+		}
+
+		// children that are reference nodes, each element is a reference node id
+		refChildren := dirEntry.GetRefChildren()
+		for j := 0; j < len(refChildren); j++ {
+			refs = append(refs, refChild{Parent: dirEntry.GetParent(), Ref: refChildren[j]})
+		}
+		if err = tree.storage.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	fr = nil
+	return refs, nil
+}
+
+// ReadReferenceTree reads the INODE_REFERENCE section into inodeReference.
+func (img *Image) ReadReferenceTree(inodeReference *NodeRefTree) error {
+
+	fr, err := img.NewSectionReader("INODE_REFERENCE")
+	if err != nil {
+		return err
+	}
+
+	inodeReferenceSection := &pb.INodeReferenceSection_INodeReference{}
+
+	i := uint32(0)
+	for {
+		if err = fr.ReadMessage(inodeReferenceSection); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		inodeReference.SetRefSnapName(i, inodeReferenceSection.GetLastSnapshotId(),
+			inodeReferenceSection.GetReferredId(), inodeReferenceSection.GetName())
+		i++
+		if err = inodeReference.storage.Err(); err != nil {
+			return err
+		}
+	}
+
+	fr = nil
+	return nil
+}
+
+// ReadStrings reads the STRING_TABLE section into strings.
+func (img *Image) ReadStrings(strings map[uint32]string) error {
+
+	fr, err := img.NewSectionReader("STRING_TABLE")
+	if err != nil {
+		return err
+	}
+
+	stringTableSection := &pb.StringTableSection{}
+	if err = fr.ReadMessage(stringTableSection); err != nil {
+		return err
+	}
+
+	entry := &pb.StringTableSection_Entry{}
+	for {
+		if err = fr.ReadMessage(entry); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+
+		strings[entry.GetId()] = entry.GetStr()
+	}
+
+	fr = nil
+	return nil
+}
+
+// ReadFilesUnderConstruction reads the FILES_UNDER_CONSTRUCTION section, the
+// files with a lease, into full paths by inode id.
+func (img *Image) ReadFilesUnderConstruction() (map[uint64]string, error) {
+
+	fr, err := img.NewSectionReader("FILES_UNDER_CONSTRUCTION")
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[uint64]string)
+	entry := &pb.FilesUnderConstructionSection_FileUnderConstructionEntry{}
+	for {
+		if err = fr.ReadMessage(entry); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		files[entry.GetInodeId()] = entry.GetFullPath()
+	}
+
+	return files, nil
+}
+
+// ReadNameSystem reads the NS_INFO section with the namespace id, generation
+// stamps and the transaction id of the image.
+func (img *Image) ReadNameSystem() (*pb.NameSystemSection, error) {
+
+	fr, err := img.NewSectionReader("NS_INFO")
+	if err != nil {
+		return nil, err
+	}
+
+	nameSystem := &pb.NameSystemSection{}
+	if err = fr.ReadMessage(nameSystem); err != nil {
+		return nil, err
+	}
+	return nameSystem, nil
+}
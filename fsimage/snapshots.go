@@ -0,0 +1,79 @@
+package fsimage
+
+import (
+	"fmt"
+)
+
+// addSnapshots registers snapshot roots. They are placed into the tree as soon
+// as the name (or the full path with snapReplace) of their directory is known.
+func (t *NodeTree) addSnapshots(roots []snapshotRoot, snapReplace bool) {
+	if t.snapshots == nil {
+		t.snapshots = make(map[uint64][]snapshotRoot)
+	}
+	t.snapReplace = snapReplace
+	for _, root := range roots {
+		t.snapshots[root.Id] = append(t.snapshots[root.Id], root)
+	}
+}
+
+// nameSnapshots places pending snapshot roots of directory key into the tree.
+// In strict mode it returns false if the directory name is not known yet.
+func (t *NodeTree) nameSnapshots(key uint64, strict bool) bool {
+	roots, exists := t.snapshots[key]
+	if !exists {
+		return true
+	}
+
+	if t.snapReplace {
+		// the directory path itself does not depend on its snapshots
+		delete(t.snapshots, key)
+		snapNames := make([]string, 0, len(roots))
+		for _, root := range roots {
+			paths, err := t.resolvePaths(key, string(root.Name), true, true, strict)
+			if err == errorPending {
+				t.snapshots[key] = roots
+				return false
+			}
+			// a broken directory only loses its snapshots, the error is
+			// reported when the directory itself is resolved
+			if err != nil {
+				paths = nil
+			}
+			if len(paths) > 0 {
+				snapNames = append(snapNames, fmt.Sprintf("%s/%s%s", SnapshotPrefix, string(root.Name), paths[0].Path))
+			} else {
+				snapNames = append(snapNames, "")
+			}
+		}
+		for i, root := range roots {
+			if snapNames[i] != "" {
+				t.SetParentName(key, root.SnapId, RootInodeID, []byte(snapNames[i]))
+			}
+		}
+		return true
+	}
+
+	ps := t.GetParents(key)
+	if strict && len(ps) > 0 && len(ps[0].Name) == 0 {
+		return false
+	}
+	delete(t.snapshots, key)
+	for _, root := range roots {
+		ps := t.GetParents(key)
+		if len(ps) == 0 {
+			break
+		}
+		snapName := fmt.Sprintf("%s/.snapshot/%s", ps[0].Name, string(root.Name))
+		t.SetParentName(key, root.SnapId, ps[0].Parent, []byte(snapName))
+	}
+	return true
+}
+
+// nameAllSnapshots places all pending snapshot roots, whether names are known
+// or not. It is called when all names are read.
+func (t *NodeTree) nameAllSnapshots() {
+	for key := range t.snapshots {
+		t.nameSnapshots(key, false)
+	}
+	t.named = true
+}
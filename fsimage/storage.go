@@ -0,0 +1,124 @@
+package fsimage
+
+import (
+	"fmt"
+	"sync"
+	"unsafe"
+)
+
+// storage allocates the big arrays of NodeTree and NodeRefTree. Without a
+// directory they live on the heap. With a directory every array is a memory
+// mapped temp file, so the kernel can write pages out instead of the process
+// being killed when the tree does not fit in RAM.
+type storage struct {
+	dir    string
+	mu     sync.Mutex
+	mapped map[uintptr][]byte
+	err    error
+}
+
+func newStorage(dir string) *storage {
+	return &storage{
+		dir:    dir,
+		mapped: make(map[uintptr][]byte),
+	}
+}
+
+// spill reports whether arrays are memory mapped temp files
+func (s *storage) spill() bool {
+	return s != nil && s.dir != ""
+}
+
+// alloc returns size zeroed bytes aligned to 8
+func (s *storage) alloc(size int) []byte {
+	if size == 0 {
+		return nil
+	}
+	if s.spill() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		b, err := mapFile(s.dir, size)
+		if err == nil {
+			s.mapped[uintptr(unsafe.Pointer(&b[0]))] = b
+			return b
+		}
+		// the caller gets working memory on the heap and stops at the next Err
+		if s.err == nil {
+			s.err = fmt.Errorf("can't spill %d bytes to %s: %s", size, s.dir, err)
+		}
+	}
+	words := make([]uint64, (size+7)/8)
+	return unsafe.Slice((*byte)(unsafe.Pointer(&words[0])), size)
+}
+
+// free releases memory returned by alloc. p is the first element of the array.
+func (s *storage) free(p unsafe.Pointer) {
+	if !s.spill() || p == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if b, ok := s.mapped[uintptr(p)]; ok {
+		delete(s.mapped, uintptr(p))
+		unmapFile(b)
+	}
+}
+
+// Err returns the first error of mapping a temp file. Loaders check it after
+// every frame, so a failed spill stops the load instead of filling the heap.
+func (s *storage) Err() error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Close unmaps all arrays. They must not be used afterwards.
+func (s *storage) Close() error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	for p, b := range s.mapped {
+		if e := unmapFile(b); e != nil && err == nil {
+			err = e
+		}
+		delete(s.mapped, p)
+	}
+	return err
+}
+
+func (s *storage) uint32s(n int) []uint32 {
+	b := s.alloc(n * 4)
+	if b == nil {
+		return nil
+	}
+	return unsafe.Slice((*uint32)(unsafe.Pointer(&b[0])), n)
+}
+
+func (s *storage) uint64s(n int) []uint64 {
+	b := s.alloc(n * 8)
+	if b == nil {
+		return nil
+	}
+	return unsafe.Slice((*uint64)(unsafe.Pointer(&b[0])), n)
+}
+
+func (s *storage) freeUint32s(a []uint32) {
+	if cap(a) > 0 {
+		s.free(unsafe.Pointer(&a[:1][0]))
+	}
+}
+
+func (s *storage) freeUint64s(a []uint64) {
+	if cap(a) > 0 {
+		s.free(unsafe.Pointer(&a[:1][0]))
+	}
+}
@@ -0,0 +1,68 @@
+//go:build !windows
+// +build !windows
+
+package fsimage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStorageSpill(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := newStorage(dir)
+	defer s.Close()
+
+	// names of many inodes share one mapping
+	a := nameArena{storage: s}
+	refs := make([]uint64, 10000)
+	for i := range refs {
+		refs[i] = a.add([]byte(fmt.Sprintf("name-%d", i)))
+	}
+	for i, ref := range refs {
+		if got := string(a.get(ref)); got != fmt.Sprintf("name-%d", i) {
+			t.Fatalf("name %d = %q", i, got)
+		}
+	}
+	if len(a.chunks) != 1 || len(s.mapped) != 1 {
+		t.Errorf("chunks %d, mappings %d", len(a.chunks), len(s.mapped))
+	}
+
+	a32 := s.uint32s(1000)
+	a32[999] = 7
+	s.freeUint32s(a32)
+	if len(s.mapped) != 1 {
+		t.Errorf("mappings after free = %d", len(s.mapped))
+	}
+	if err = s.Err(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestStorageSpillError(t *testing.T) {
+	dir := filepath.Join(os.TempDir(), "hdfs-fsimage-dump-missing")
+
+	s := newStorage(dir)
+	b := s.alloc(100)
+	if len(b) != 100 {
+		t.Errorf("alloc = %d bytes", len(b))
+	}
+	if err := s.Err(); err == nil || !strings.Contains(err.Error(), dir) {
+		t.Errorf("error %v", err)
+	}
+
+	b2, _ := newShuffledTree(t)
+	img := b2.open(t)
+	if _, err := img.LoadNamespaceWith(NamespaceOptions{SpillDir: dir}); err == nil || !strings.Contains(err.Error(), "can't spill") {
+		t.Errorf("load error %v", err)
+	}
+}
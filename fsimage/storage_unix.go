@@ -0,0 +1,30 @@
+//go:build !windows
+// +build !windows
+
+package fsimage
+
+import (
+	"io/ioutil"
+	"os"
+	"syscall"
+)
+
+// mapFile maps a new temp file of size bytes in dir. The file is removed
+// right away and lives until the mapping is released.
+func mapFile(dir string, size int) ([]byte, error) {
+	f, err := ioutil.TempFile(dir, "hdfs-fsimage-dump-")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	os.Remove(f.Name())
+
+	if err = f.Truncate(int64(size)); err != nil {
+		return nil, err
+	}
+	return syscall.Mmap(int(f.Fd()), 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+}
+
+func unmapFile(b []byte) error {
+	return syscall.Munmap(b)
+}
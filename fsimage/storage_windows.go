@@ -0,0 +1,11 @@
+package fsimage
+
+import "errors"
+
+func mapFile(dir string, size int) ([]byte, error) {
+	return nil, errors.New("memory mapped spill files are not supported on windows")
+}
+
+func unmapFile(b []byte) error {
+	return nil
+}
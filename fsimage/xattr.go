@@ -0,0 +1,52 @@
+package fsimage
+
+import (
+	pb "github.com/lomik/hdfs-fsimage-dump/pb/hadoop_hdfs_fsimage"
+)
+
+// packing of XAttrCompactProto names, see XAttrFormat
+const (
+	xattrNamespaceOffset    = 30
+	xattrNamespaceMask      = 3
+	xattrNamespaceExtOffset = 5
+	xattrNamespaceExtMask   = 1
+	xattrNameOffset         = 6
+	xattrNameMask           = 1<<24 - 1
+)
+
+// XAttrNamespaces are the xattr namespaces by their number
+var XAttrNamespaces = []string{"user", "trusted", "security", "system", "raw"}
+
+// XAttr is an extended attribute of an inode.
+type XAttr struct {
+	Namespace int
+	Name      string
+	Value     []byte
+}
+
+// FullName returns the name with its namespace prefix, like "user.tag".
+func (x XAttr) FullName() string {
+	if x.Namespace < len(XAttrNamespaces) {
+		return XAttrNamespaces[x.Namespace] + "." + x.Name
+	}
+	return x.Name
+}
+
+// XAttrs decodes the xattrs of an inode, nil without the xattr feature.
+func (ns *Namespace) XAttrs(xattrs *pb.INodeSection_XAttrFeatureProto) []XAttr {
+	if xattrs == nil {
+		return nil
+	}
+	res := make([]XAttr, 0, len(xattrs.GetXAttrs()))
+	for _, x := range xattrs.GetXAttrs() {
+		v := x.GetName()
+		namespace := int(v>>xattrNamespaceOffset)&xattrNamespaceMask |
+			int(v>>xattrNamespaceExtOffset)&xattrNamespaceExtMask<<2
+		res = append(res, XAttr{
+			Namespace: namespace,
+			Name:      ns.Strings[(v>>xattrNameOffset)&xattrNameMask],
+			Value:     x.GetValue(),
+		})
+	}
+	return res
+}
@@ -0,0 +1,52 @@
+package fsimage
+
+import (
+	"reflect"
+	"testing"
+
+	pb "github.com/lomik/hdfs-fsimage-dump/pb/hadoop_hdfs_fsimage"
+)
+
+// xattrName packs a name like XAttrFormat, the high namespace bit is apart
+func xattrName(namespace int, name uint32) uint32 {
+	return uint32(namespace&xattrNamespaceMask)<<xattrNamespaceOffset |
+		uint32(namespace>>2&xattrNamespaceExtMask)<<xattrNamespaceExtOffset |
+		name<<xattrNameOffset
+}
+
+func TestXAttrs(t *testing.T) {
+	ns := &Namespace{Strings: map[uint32]string{1: "tag", 2: "hdfs.crypto.encryption.zone", xattrNameMask: "last"}}
+
+	tests := []struct {
+		name     uint32
+		want     XAttr
+		fullName string
+	}{
+		{xattrName(0, 1), XAttr{Namespace: 0, Name: "tag"}, "user.tag"},
+		{xattrName(1, 1), XAttr{Namespace: 1, Name: "tag"}, "trusted.tag"},
+		{xattrName(2, 1), XAttr{Namespace: 2, Name: "tag"}, "security.tag"},
+		{xattrName(3, xattrNameMask), XAttr{Namespace: 3, Name: "last"}, "system.last"},
+		{xattrName(4, 2), XAttr{Namespace: 4, Name: "hdfs.crypto.encryption.zone"}, "raw.hdfs.crypto.encryption.zone"},
+		{1 << xattrNamespaceExtOffset, XAttr{Namespace: 4}, "raw."},
+		{xattrName(5, 1), XAttr{Namespace: 5, Name: "tag"}, "tag"},
+	}
+
+	for _, tt := range tests {
+		value := []byte{byte(tt.name)}
+		got := ns.XAttrs(&pb.INodeSection_XAttrFeatureProto{
+			XAttrs: []*pb.INodeSection_XAttrCompactProto{{Name: &tt.name, Value: value}},
+		})
+		tt.want.Value = value
+		if len(got) != 1 || !reflect.DeepEqual(got[0], tt.want) {
+			t.Errorf("%#x: %+v, want %+v", tt.name, got, tt.want)
+			continue
+		}
+		if s := got[0].FullName(); s != tt.fullName {
+			t.Errorf("%#x: %q, want %q", tt.name, s, tt.fullName)
+		}
+	}
+
+	if got := ns.XAttrs(nil); got != nil {
+		t.Errorf("no feature: %v", got)
+	}
+}
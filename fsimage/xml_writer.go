@@ -0,0 +1,757 @@
+package fsimage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	pb "github.com/lomik/hdfs-fsimage-dump/pb/hadoop_hdfs_fsimage"
+)
+
+// XMLRevision is written as oivRevision in the version element
+const XMLRevision = "hdfs-fsimage-dump"
+
+// xmlWriter writes the elements of PBImageXmlWriter, numbers are printed as
+// the signed Java types of the fields.
+type xmlWriter struct {
+	img *Image
+	ns  *Namespace
+	w   *bufio.Writer
+	buf []byte
+}
+
+// WriteXML writes every section of the image as XML in the schema of
+// `hdfs oiv -p XML`. Sections are written in the order of SectionNames.
+func (img *Image) WriteXML(w io.Writer) error {
+	ns := &Namespace{Strings: make(map[uint32]string)}
+	if err := img.ReadStrings(ns.Strings); err != nil {
+		return err
+	}
+
+	x := &xmlWriter{
+		img: img,
+		ns:  ns,
+		w:   bufio.NewWriterSize(w, 1<<20),
+	}
+	x.print("<?xml version=\"1.0\"?>\n<fsimage>")
+	x.print("<version>")
+	x.oInt("layoutVersion", int64(int32(img.Summary.GetLayoutVersion())))
+	x.oInt("onDiskVersion", int64(int32(img.Summary.GetOndiskVersion())))
+	x.o("oivRevision", XMLRevision)
+	x.print("</version>\n")
+
+	sections := map[string]func() error{
+		"NS_INFO":                  x.nameSection,
+		"ERASURE_CODING":           x.erasureCodingSection,
+		"INODE":                    x.inodeSection,
+		"INODE_REFERENCE":          x.inodeReferenceSection,
+		"SNAPSHOT":                 x.snapshotSection,
+		"SNAPSHOT_DIFF":            x.snapshotDiffSection,
+		"INODE_DIR":                x.inodeDirectorySection,
+		"FILES_UNDER_CONSTRUCTION": x.fileUnderConstructionSection,
+		"SECRET_MANAGER":           x.secretManagerSection,
+		"CACHE_MANAGER":            x.cacheManagerSection,
+	}
+	for _, name := range SectionNames {
+		section, ok := sections[name]
+		if !ok || img.Sections[name] == nil {
+			continue
+		}
+		if err := section(); err != nil {
+			return err
+		}
+	}
+
+	x.print("</fsimage>\n")
+	return x.w.Flush()
+}
+
+func (x *xmlWriter) print(s string) {
+	x.w.WriteString(s)
+}
+
+// o writes an element with an escaped text value
+func (x *xmlWriter) o(name string, value string) {
+	x.buf = append(x.buf[:0], '<')
+	x.buf = append(x.buf, name...)
+	x.buf = append(x.buf, '>')
+	x.buf = appendXMLString(x.buf, value)
+	x.buf = append(x.buf, "</"...)
+	x.buf = append(x.buf, name...)
+	x.buf = append(x.buf, '>')
+	x.w.Write(x.buf)
+}
+
+func (x *xmlWriter) oInt(name string, value int64) {
+	x.buf = append(x.buf[:0], '<')
+	x.buf = append(x.buf, name...)
+	x.buf = append(x.buf, '>')
+	x.buf = strconv.AppendInt(x.buf, value, 10)
+	x.buf = append(x.buf, "</"...)
+	x.buf = append(x.buf, name...)
+	x.buf = append(x.buf, '>')
+	x.w.Write(x.buf)
+}
+
+func (x *xmlWriter) oBool(name string, value bool) {
+	x.o(name, strconv.FormatBool(value))
+}
+
+// oDate writes milliseconds since the epoch like PBImageXmlWriter.dumpDate
+func (x *xmlWriter) oDate(name string, ms uint64) {
+	x.o(name, time.Unix(0, int64(ms)*1e6).UTC().Format("2006-01-02T15:04:05.000"))
+}
+
+// appendXMLString escapes s like XMLUtils.mangleXmlString with entity refs:
+// control characters other than tab and line breaks and backslash become \<hex>;
+func appendXMLString(dst []byte, s string) []byte {
+	for _, r := range s {
+		switch {
+		case r < 0x20 && r != '\t' && r != '\n' && r != '\r' || r == 0xfffe || r == 0xffff || r == '\\':
+			dst = append(dst, '\\')
+			dst = strconv.AppendInt(dst, int64(r), 16)
+			dst = append(dst, ';')
+		case r == '&':
+			dst = append(dst, "&amp;"...)
+		case r == '"':
+			dst = append(dst, "&quot;"...)
+		case r == '\'':
+			dst = append(dst, "&apos;"...)
+		case r == '<':
+			dst = append(dst, "&lt;"...)
+		case r == '>':
+			dst = append(dst, "&gt;"...)
+		default:
+			var b [utf8.UTFMax]byte
+			n := utf8.EncodeRune(b[:], r)
+			dst = append(dst, b[:n]...)
+		}
+	}
+	return dst
+}
+
+// permission formats a packed permission as user:group:mode
+func (x *xmlWriter) permission(permission uint64) string {
+	return fmt.Sprintf("%s:%s:%04o", x.ns.User(permission), x.ns.Group(permission), permission&01777)
+}
+
+func (x *xmlWriter) nameSection() error {
+	fr, err := x.img.NewSectionReader("NS_INFO")
+	if err != nil {
+		return err
+	}
+	s := &pb.NameSystemSection{}
+	if err = fr.ReadMessage(s); err != nil {
+		return err
+	}
+
+	x.print("<NameSection>")
+	x.oInt("namespaceId", int64(int32(s.GetNamespaceId())))
+	x.oInt("genstampV1", int64(s.GetGenstampV1()))
+	x.oInt("genstampV2", int64(s.GetGenstampV2()))
+	x.oInt("genstampV1Limit", int64(s.GetGenstampV1Limit()))
+	x.oInt("lastAllocatedBlockId", int64(s.GetLastAllocatedBlockId()))
+	x.oInt("txid", int64(s.GetTransactionId()))
+	x.print("</NameSection>\n")
+	return nil
+}
+
+// erasureCodingPolicyStates are the names of ErasureCodingPolicyState
+var erasureCodingPolicyStates = map[uint64]string{1: "DISABLED", 2: "ENABLED", 3: "REMOVED"}
+
+func (x *xmlWriter) erasureCodingSection() error {
+	fr, err := x.img.NewSectionReader("ERASURE_CODING")
+	if err != nil {
+		return err
+	}
+	frame, err := fr.ReadFrame()
+	if err != nil {
+		return err
+	}
+
+	// ErasureCodingPolicyProto and ECSchemaProto are decoded by field
+	// numbers, they are not compiled into pb
+	var policies [][]byte
+	err = eachWireField(frame, func(num uint64, f wireField) error {
+		if num == 1 {
+			policies = append(policies, f.bytes)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	x.print("<ErasureCodingSection>")
+	for _, p := range policies {
+		var policy, schema [6]wireField
+		policy[5].varint = 2
+		if err = decodeWireFields(p, policy[:]); err != nil {
+			return err
+		}
+		var options [][2]string
+		err = eachWireField(policy[2].bytes, func(num uint64, f wireField) error {
+			if num < uint64(len(schema)) {
+				schema[num] = f
+			}
+			if num != 4 {
+				return nil
+			}
+			var option [3]wireField
+			if err := decodeWireFields(f.bytes, option[:]); err != nil {
+				return err
+			}
+			options = append(options, [2]string{string(option[1].bytes), string(option[2].bytes)})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		x.print("<erasureCodingPolicy>")
+		x.oInt("policyId", int64(int8(policy[4].varint)))
+		x.o("policyName", string(policy[1].bytes))
+		x.oInt("cellSize", int64(int32(policy[3].varint)))
+		x.o("policyState", erasureCodingPolicyStates[policy[5].varint])
+		x.print("<ecSchema>")
+		x.o("codecName", string(schema[1].bytes))
+		x.oInt("dataUnits", int64(int32(schema[2].varint)))
+		x.oInt("parityUnits", int64(int32(schema[3].varint)))
+		if len(options) > 0 {
+			x.print("<extraOptions>")
+			for _, option := range options {
+				x.print("<option>")
+				x.o("key", option[0])
+				x.o("value", option[1])
+				x.print("</option>")
+			}
+			x.print("</extraOptions>")
+		}
+		x.print("</ecSchema>")
+		x.print("</erasureCodingPolicy>\n")
+	}
+	x.print("</ErasureCodingSection>\n")
+	return nil
+}
+
+func (x *xmlWriter) inodeSection() error {
+	inodes, err := x.img.NewINodeReader()
+	if err != nil {
+		return err
+	}
+
+	x.print("<INodeSection>")
+	x.oInt("lastInodeId", int64(inodes.Section.GetLastInodeId()))
+	x.oInt("numInodes", int64(inodes.Section.GetNumInodes()))
+	x.print("\n")
+	for {
+		inode, err := inodes.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		x.print("<inode>")
+		x.inodeFields(inode)
+		x.print("</inode>\n")
+	}
+	x.print("</INodeSection>\n")
+	return nil
+}
+
+func (x *xmlWriter) inodeFields(inode *pb.INodeSection_INode) {
+	x.oInt("id", int64(inode.GetId()))
+	x.o("type", inode.GetType().String())
+	x.o("name", string(inode.GetName()))
+	if inode.File != nil {
+		x.inodeFile(inode.File)
+	} else if inode.Directory != nil {
+		x.inodeDirectory(inode.Directory)
+	} else if inode.Symlink != nil {
+		x.inodeSymlink(inode.Symlink)
+	}
+}
+
+func (x *xmlWriter) inodeFile(f *pb.INodeSection_INodeFile) {
+	x.oInt("replication", int64(int32(f.GetReplication())))
+	x.oInt("mtime", int64(f.GetModificationTime()))
+	x.oInt("atime", int64(f.GetAccessTime()))
+	x.oInt("preferredBlockSize", int64(f.GetPreferredBlockSize()))
+	x.o("permission", x.permission(f.GetPermission()))
+	if f.XAttrs != nil {
+		x.xattrs(f.XAttrs)
+	}
+	x.acls(f.Acl)
+	if len(f.GetBlocks()) > 0 {
+		x.print("<blocks>")
+		for _, b := range f.GetBlocks() {
+			x.print("<block>")
+			x.oInt("id", int64(b.GetBlockId()))
+			x.oInt("genstamp", int64(b.GetGenStamp()))
+			x.oInt("numBytes", int64(b.GetNumBytes()))
+			x.print("</block>\n")
+		}
+		x.print("</blocks>\n")
+	}
+	if uc := f.GetFileUC(); uc != nil {
+		x.print("<file-under-construction>")
+		x.o("clientName", uc.GetClientName())
+		x.o("clientMachine", uc.GetClientMachine())
+		x.print("</file-under-construction>\n")
+	}
+}
+
+func (x *xmlWriter) inodeDirectory(d *pb.INodeSection_INodeDirectory) {
+	x.oInt("mtime", int64(d.GetModificationTime()))
+	x.o("permission", x.permission(d.GetPermission()))
+	if d.XAttrs != nil {
+		x.xattrs(d.XAttrs)
+	}
+	x.acls(d.Acl)
+	x.oInt("nsquota", int64(d.GetNsQuota()))
+	x.oInt("dsquota", int64(d.GetDsQuota()))
+}
+
+func (x *xmlWriter) inodeSymlink(s *pb.INodeSection_INodeSymlink) {
+	x.o("permission", x.permission(s.GetPermission()))
+	x.o("target", string(s.GetTarget()))
+	x.oInt("mtime", int64(s.GetModificationTime()))
+	x.oInt("atime", int64(s.GetAccessTime()))
+}
+
+func (x *xmlWriter) acls(acl *pb.INodeSection_AclFeatureProto) {
+	entries := x.ns.AclEntries(acl)
+	if len(entries) == 0 {
+		return
+	}
+	x.print("<acls>")
+	for _, e := range entries {
+		x.o("acl", e.String())
+	}
+	x.print("</acls>")
+}
+
+func (x *xmlWriter) xattrs(xattrs *pb.INodeSection_XAttrFeatureProto) {
+	x.print("<xattrs>")
+	for _, xattr := range x.ns.XAttrs(xattrs) {
+		x.print("<xattr>")
+		if xattr.Namespace < len(XAttrNamespaces) {
+			x.o("ns", strings.ToUpper(XAttrNamespaces[xattr.Namespace]))
+		}
+		x.o("name", xattr.Name)
+		if xattr.Value != nil {
+			if utf8.Valid(xattr.Value) {
+				x.o("val", string(xattr.Value))
+			} else {
+				x.o("valHex", hex.EncodeToString(xattr.Value))
+			}
+		}
+		x.print("</xattr>")
+	}
+	x.print("</xattrs>")
+}
+
+func (x *xmlWriter) inodeReferenceSection() error {
+	fr, err := x.img.NewSectionReader("INODE_REFERENCE")
+	if err != nil {
+		return err
+	}
+
+	x.print("<INodeReferenceSection>")
+	ref := &pb.INodeReferenceSection_INodeReference{}
+	for {
+		if err = fr.ReadMessage(ref); err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		x.print("<ref>")
+		x.oInt("referredId", int64(ref.GetReferredId()))
+		x.o("name", string(ref.GetName()))
+		x.oInt("dstSnapshotId", int64(int32(ref.GetDstSnapshotId())))
+		x.oInt("lastSnapshotId", int64(int32(ref.GetLastSnapshotId())))
+		x.print("</ref>\n")
+	}
+	x.print("</INodeReferenceSection>\n")
+	return nil
+}
+
+func (x *xmlWriter) snapshotSection() error {
+	fr, err := x.img.NewSectionReader("SNAPSHOT")
+	if err != nil {
+		return err
+	}
+	s := &pb.SnapshotSection{}
+	if err = fr.ReadMessage(s); err != nil {
+		return err
+	}
+
+	x.print("<SnapshotSection>")
+	x.oInt("snapshotCounter", int64(int32(s.GetSnapshotCounter())))
+	x.oInt("numSnapshots", int64(int32(s.GetNumSnapshots())))
+	if len(s.GetSnapshottableDir()) > 0 {
+		x.print("<snapshottableDir>")
+		for _, id := range s.GetSnapshottableDir() {
+			x.oInt("dir", int64(id))
+		}
+		x.print("</snapshottableDir>\n")
+	}
+	snapshot := &pb.SnapshotSection_Snapshot{}
+	for i := uint32(0); i < s.GetNumSnapshots(); i++ {
+		if err = fr.ReadMessage(snapshot); err != nil {
+			return err
+		}
+		x.print("<snapshot>")
+		x.oInt("id", int64(int32(snapshot.GetSnapshotId())))
+		x.print("<root>")
+		x.inodeFields(snapshot.GetRoot())
+		x.print("</root>")
+		x.print("</snapshot>")
+	}
+	x.print("</SnapshotSection>\n")
+	return nil
+}
+
+func (x *xmlWriter) snapshotDiffSection() error {
+	fr, err := x.img.NewSectionReader("SNAPSHOT_DIFF")
+	if err != nil {
+		return err
+	}
+
+	x.print("<SnapshotDiffSection>")
+	entry := &pb.SnapshotDiffSection_DiffEntry{}
+	fileDiff := &pb.SnapshotDiffSection_FileDiff{}
+	dirDiff := &pb.SnapshotDiffSection_DirectoryDiff{}
+	created := &pb.SnapshotDiffSection_CreatedListEntry{}
+	for {
+		if err = fr.ReadMessage(entry); err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		var tag string
+		switch entry.GetType() {
+		case pb.SnapshotDiffSection_DiffEntry_FILEDIFF:
+			tag = "fileDiffEntry"
+		case pb.SnapshotDiffSection_DiffEntry_DIRECTORYDIFF:
+			tag = "dirDiffEntry"
+		default:
+			return fmt.Errorf("unknown DiffEntry type %s", entry.GetType())
+		}
+		x.print("<" + tag + ">")
+		x.oInt("inodeId", int64(entry.GetInodeId()))
+		x.oInt("count", int64(int32(entry.GetNumOfDiff())))
+
+		for i := uint32(0); i < entry.GetNumOfDiff(); i++ {
+			if entry.GetType() == pb.SnapshotDiffSection_DiffEntry_FILEDIFF {
+				if err = fr.ReadMessage(fileDiff); err != nil {
+					return err
+				}
+				x.print("<fileDiff>")
+				x.oInt("snapshotId", int64(int32(fileDiff.GetSnapshotId())))
+				x.oInt("size", int64(fileDiff.GetFileSize()))
+				x.o("name", string(fileDiff.GetName()))
+				if fileDiff.SnapshotCopy != nil {
+					x.print("<snapshotCopy>")
+					x.inodeFile(fileDiff.SnapshotCopy)
+					x.print("</snapshotCopy>\n")
+				}
+				x.print("</fileDiff>\n")
+				continue
+			}
+
+			if err = fr.ReadMessage(dirDiff); err != nil {
+				return err
+			}
+			x.print("<dirDiff>")
+			x.oInt("snapshotId", int64(int32(dirDiff.GetSnapshotId())))
+			x.oInt("childrenSize", int64(int32(dirDiff.GetChildrenSize())))
+			x.oBool("isSnapshotRoot", dirDiff.GetIsSnapshotRoot())
+			x.o("name", string(dirDiff.GetName()))
+			if dirDiff.SnapshotCopy != nil {
+				x.print("<snapshotCopy>")
+				x.inodeDirectory(dirDiff.SnapshotCopy)
+				x.print("</snapshotCopy>\n")
+			}
+			x.oInt("createdListSize", int64(int32(dirDiff.GetCreatedListSize())))
+			for _, id := range dirDiff.GetDeletedINode() {
+				x.oInt("deletedInode", int64(id))
+			}
+			for _, id := range dirDiff.GetDeletedINodeRef() {
+				x.oInt("deletedInoderef", int64(int32(id)))
+			}
+			for j := uint32(0); j < dirDiff.GetCreatedListSize(); j++ {
+				if err = fr.ReadMessage(created); err != nil {
+					return err
+				}
+				x.print("<created>")
+				x.o("name", string(created.GetName()))
+				x.print("</created>\n")
+			}
+			x.print("</dirDiff>\n")
+		}
+		x.print("</" + tag + ">\n")
+	}
+	x.print("</SnapshotDiffSection>\n")
+	return nil
+}
+
+func (x *xmlWriter) inodeDirectorySection() error {
+	fr, err := x.img.NewSectionReader("INODE_DIR")
+	if err != nil {
+		return err
+	}
+
+	x.print("<INodeDirectorySection>")
+	dirEntry := &pb.INodeDirectorySection_DirEntry{}
+	for {
+		if err = fr.ReadMessage(dirEntry); err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		x.print("<directory>")
+		x.oInt("parent", int64(dirEntry.GetParent()))
+		for _, id := range dirEntry.GetChildren() {
+			x.oInt("child", int64(id))
+		}
+		for _, id := range dirEntry.GetRefChildren() {
+			x.oInt("refChild", int64(int32(id)))
+		}
+		x.print("</directory>\n")
+	}
+	x.print("</INodeDirectorySection>\n")
+	return nil
+}
+
+func (x *xmlWriter) fileUnderConstructionSection() error {
+	fr, err := x.img.NewSectionReader("FILES_UNDER_CONSTRUCTION")
+	if err != nil {
+		return err
+	}
+
+	x.print("<FileUnderConstructionSection>")
+	entry := &pb.FilesUnderConstructionSection_FileUnderConstructionEntry{}
+	for {
+		if err = fr.ReadMessage(entry); err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		x.print("<inode>")
+		x.oInt("id", int64(entry.GetInodeId()))
+		x.o("path", entry.GetFullPath())
+		x.print("</inode>\n")
+	}
+	x.print("</FileUnderConstructionSection>\n")
+	return nil
+}
+
+func (x *xmlWriter) secretManagerSection() error {
+	fr, err := x.img.NewSectionReader("SECRET_MANAGER")
+	if err != nil {
+		return err
+	}
+	s := &pb.SecretManagerSection{}
+	if err = fr.ReadMessage(s); err != nil {
+		return err
+	}
+
+	x.print("<SecretManagerSection>")
+	x.oInt("currentId", int64(int32(s.GetCurrentId())))
+	x.oInt("tokenSequenceNumber", int64(int32(s.GetTokenSequenceNumber())))
+	x.print("<delegationKeys>")
+	key := &pb.SecretManagerSection_DelegationKey{}
+	for i := uint32(0); i < s.GetNumKeys(); i++ {
+		if err = fr.ReadMessage(key); err != nil {
+			return err
+		}
+		x.print("<delegationKey>")
+		x.oInt("id", int64(int32(key.GetId())))
+		x.o("key", hex.EncodeToString(key.GetKey()))
+		if key.ExpiryDate != nil {
+			x.oDate("expiry", key.GetExpiryDate())
+		}
+		x.print("</delegationKey>")
+	}
+	x.print("</delegationKeys>")
+	x.print("<tokens>")
+	token := &pb.SecretManagerSection_PersistToken{}
+	for i := uint32(0); i < s.GetNumTokens(); i++ {
+		if err = fr.ReadMessage(token); err != nil {
+			return err
+		}
+		x.print("<token>")
+		if token.Version != nil {
+			x.oInt("version", int64(int32(token.GetVersion())))
+		}
+		if token.Owner != nil {
+			x.o("owner", token.GetOwner())
+		}
+		if token.Renewer != nil {
+			x.o("renewer", token.GetRenewer())
+		}
+		if token.RealUser != nil {
+			x.o("realUser", token.GetRealUser())
+		}
+		if token.IssueDate != nil {
+			x.oDate("issueDate", token.GetIssueDate())
+		}
+		if token.MaxDate != nil {
+			x.oDate("maxDate", token.GetMaxDate())
+		}
+		if token.SequenceNumber != nil {
+			x.oInt("sequenceNumber", int64(int32(token.GetSequenceNumber())))
+		}
+		if token.MasterKeyId != nil {
+			x.oInt("masterKeyId", int64(int32(token.GetMasterKeyId())))
+		}
+		if token.ExpiryDate != nil {
+			x.oDate("expiryDate", token.GetExpiryDate())
+		}
+		x.print("</token>")
+	}
+	x.print("</tokens>")
+	x.print("</SecretManagerSection>\n")
+	return nil
+}
+
+func (x *xmlWriter) cacheManagerSection() error {
+	fr, err := x.img.NewSectionReader("CACHE_MANAGER")
+	if err != nil {
+		return err
+	}
+	s := &pb.CacheManagerSection{}
+	if err = fr.ReadMessage(s); err != nil {
+		return err
+	}
+
+	x.print("<CacheManagerSection>")
+	x.oInt("nextDirectiveId", int64(s.GetNextDirectiveId()))
+	x.oInt("numDirectives", int64(int32(s.GetNumDirectives())))
+	x.oInt("numPools", int64(int32(s.GetNumPools())))
+
+	// CachePoolInfoProto and CacheDirectiveInfoProto are decoded by field
+	// numbers, the client protocol is not compiled into pb
+	for i := uint32(0); i < s.GetNumPools(); i++ {
+		frame, err := fr.ReadFrame()
+		if err != nil {
+			return err
+		}
+		var pool [7]wireField
+		if err = decodeWireFields(frame, pool[:]); err != nil {
+			return err
+		}
+		x.print("<pool>")
+		x.o("poolName", string(pool[1].bytes))
+		x.o("ownerName", string(pool[2].bytes))
+		x.o("groupName", string(pool[3].bytes))
+		x.oInt("mode", int64(int32(pool[4].varint)))
+		x.oInt("limit", int64(pool[5].varint))
+		x.oInt("maxRelativeExpiry", int64(pool[6].varint))
+		x.print("</pool>\n")
+	}
+	for i := uint32(0); i < s.GetNumDirectives(); i++ {
+		frame, err := fr.ReadFrame()
+		if err != nil {
+			return err
+		}
+		var directive, expiration [6]wireField
+		if err = decodeWireFields(frame, directive[:]); err != nil {
+			return err
+		}
+		if err = decodeWireFields(directive[5].bytes, expiration[:]); err != nil {
+			return err
+		}
+		x.print("<directive>")
+		x.oInt("id", int64(directive[1].varint))
+		x.o("path", string(directive[2].bytes))
+		x.oInt("replication", int64(int32(directive[3].varint)))
+		x.o("pool", string(directive[4].bytes))
+		x.print("<expiration>")
+		x.oInt("millis", int64(expiration[1].varint))
+		x.oBool("relative", expiration[2].varint != 0)
+		x.print("</expiration>\n")
+		x.print("</directive>\n")
+	}
+	x.print("</CacheManagerSection>\n")
+	return nil
+}
+
+// wireField is the last value of a varint or bytes field of a message
+type wireField struct {
+	varint uint64
+	bytes  []byte
+}
+
+// decodeWireFields puts fields of an encoded message into fields by their
+// number, fields out of range are skipped
+func decodeWireFields(msg []byte, fields []wireField) error {
+	return eachWireField(msg, func(num uint64, f wireField) error {
+		if num < uint64(len(fields)) {
+			fields[num] = f
+		}
+		return nil
+	})
+}
+
+// eachWireField calls fn with every field of an encoded message in order, so
+// repeated fields are seen
+func eachWireField(msg []byte, fn func(num uint64, f wireField) error) error {
+	for i := 0; i < len(msg); {
+		tag, n := binary.Uvarint(msg[i:])
+		if n <= 0 {
+			return ErrorBrokenSection
+		}
+		i += n
+		num := tag >> 3
+		var f wireField
+		switch tag & 7 {
+		case 0:
+			v, n := binary.Uvarint(msg[i:])
+			if n <= 0 {
+				return ErrorBrokenSection
+			}
+			i += n
+			f.varint = v
+		case 1:
+			if len(msg)-i < 8 {
+				return ErrorBrokenSection
+			}
+			f.varint = binary.LittleEndian.Uint64(msg[i:])
+			i += 8
+		case 2:
+			l, n := binary.Uvarint(msg[i:])
+			if n <= 0 || uint64(len(msg)-i-n) < l {
+				return ErrorBrokenSection
+			}
+			i += n
+			f.bytes = msg[i : i+int(l)]
+			i += int(l)
+		case 5:
+			if len(msg)-i < 4 {
+				return ErrorBrokenSection
+			}
+			f.varint = uint64(binary.LittleEndian.Uint32(msg[i:]))
+			i += 4
+		default:
+			return ErrorBrokenSection
+		}
+		if err := fn(num, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
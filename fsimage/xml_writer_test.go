@@ -0,0 +1,286 @@
+package fsimage
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/lomik/hdfs-fsimage-dump/pb/hadoop_hdfs_fsimage"
+)
+
+// wireVarint encodes a varint field
+func wireVarint(num uint64, v uint64) []byte {
+	return append(proto.EncodeVarint(num<<3), proto.EncodeVarint(v)...)
+}
+
+// wireBytes encodes a bytes field, nested messages are concatenated fields
+func wireBytes(num uint64, fields ...[]byte) []byte {
+	v := bytes.Join(fields, nil)
+	b := append(proto.EncodeVarint(num<<3|2), proto.EncodeVarint(uint64(len(v)))...)
+	return append(b, v...)
+}
+
+func TestWriteXML(t *testing.T) {
+	dir := testDir(16386, "dir")
+	dir.Directory.XAttrs = &pb.INodeSection_XAttrFeatureProto{XAttrs: []*pb.INodeSection_XAttrCompactProto{
+		{Name: proto.Uint32(xattrName(0, 4)), Value: []byte("v<1>")},
+		{Name: proto.Uint32(xattrName(1, 4)), Value: []byte{0xff, 0}},
+	}}
+	dir.Directory.Acl = &pb.INodeSection_AclFeatureProto{Entries: []uint32{
+		aclEntry(false, AclUser, 3, 5),
+		aclEntry(true, AclGroup, 0, 4),
+	}}
+	uc := testFile(16390, "uc")
+	uc.File.FileUC = &pb.INodeSection_FileUnderConstructionFeature{
+		ClientName:    proto.String("DFSClient_1"),
+		ClientMachine: proto.String("10.0.0.1"),
+	}
+	link := &pb.INodeSection_INode{
+		Type: pb.INodeSection_INode_SYMLINK.Enum(),
+		Id:   proto.Uint64(16389),
+		Name: []byte("link"),
+		Symlink: &pb.INodeSection_INodeSymlink{
+			Permission:       testPermission(0777),
+			Target:           []byte("/dir/a&<b>\"'\\\x01"),
+			ModificationTime: proto.Uint64(1505725539089),
+			AccessTime:       proto.Uint64(1505405189045),
+		},
+	}
+	inodes := []*pb.INodeSection_INode{testDir(RootInodeID, ""), dir, testFile(16387, "a&<b>\"'\\\x01", 10, 20), link, uc}
+
+	// sections are added in reverse order, they are written in the order of SectionNames
+	b := newTestImage()
+	b.add(t, "CACHE_MANAGER", &pb.CacheManagerSection{
+		NextDirectiveId: proto.Uint64(3), NumPools: proto.Uint32(1), NumDirectives: proto.Uint32(1),
+	})
+	b.addRaw("CACHE_MANAGER", bytes.Join([][]byte{
+		wireBytes(1, []byte("pool1")), wireBytes(2, []byte("hdfs")), wireBytes(3, []byte("supergroup")),
+		wireVarint(4, 0755), wireVarint(5, 1000), wireVarint(6, 1<<61-1),
+	}, nil))
+	b.addRaw("CACHE_MANAGER", bytes.Join([][]byte{
+		wireVarint(1, 2), wireBytes(2, []byte("/data")), wireVarint(3, 2), wireBytes(4, []byte("pool1")),
+		wireBytes(5, wireVarint(1, 86400000), wireVarint(2, 1)),
+	}, nil))
+	b.add(t, "SECRET_MANAGER",
+		&pb.SecretManagerSection{
+			CurrentId: proto.Uint32(2), TokenSequenceNumber: proto.Uint32(7), NumKeys: proto.Uint32(1), NumTokens: proto.Uint32(1),
+		},
+		&pb.SecretManagerSection_DelegationKey{Id: proto.Uint32(2), ExpiryDate: proto.Uint64(1505725539089), Key: []byte{0xde, 0xad}},
+		&pb.SecretManagerSection_PersistToken{
+			Version: proto.Uint32(0), Owner: proto.String("alice"), Renewer: proto.String("yarn"), RealUser: proto.String(""),
+			IssueDate: proto.Uint64(1505725539089), MaxDate: proto.Uint64(1506330339089), SequenceNumber: proto.Uint32(7),
+			MasterKeyId: proto.Uint32(2), ExpiryDate: proto.Uint64(1505811939089),
+		})
+	b.add(t, "FILES_UNDER_CONSTRUCTION", &pb.FilesUnderConstructionSection_FileUnderConstructionEntry{
+		InodeId: proto.Uint64(16390), FullPath: proto.String("/dir/uc"),
+	})
+	b.add(t, "INODE_DIR",
+		&pb.INodeDirectorySection_DirEntry{Parent: proto.Uint64(RootInodeID), Children: []uint64{16386, 16389}},
+		&pb.INodeDirectorySection_DirEntry{Parent: proto.Uint64(16386), Children: []uint64{16387, 16390}, RefChildren: []uint32{0}})
+	b.add(t, "SNAPSHOT_DIFF",
+		&pb.SnapshotDiffSection_DiffEntry{
+			Type: pb.SnapshotDiffSection_DiffEntry_DIRECTORYDIFF.Enum(), InodeId: proto.Uint64(16386), NumOfDiff: proto.Uint32(1),
+		},
+		&pb.SnapshotDiffSection_DirectoryDiff{
+			SnapshotId: proto.Uint32(0), ChildrenSize: proto.Uint32(2), IsSnapshotRoot: proto.Bool(true), Name: []byte("s0"),
+			SnapshotCopy: testDir(16386, "dir").Directory, CreatedListSize: proto.Uint32(1),
+			DeletedINode: []uint64{16388}, DeletedINodeRef: []uint32{0},
+		},
+		&pb.SnapshotDiffSection_CreatedListEntry{Name: []byte("uc")},
+		&pb.SnapshotDiffSection_DiffEntry{
+			Type: pb.SnapshotDiffSection_DiffEntry_FILEDIFF.Enum(), InodeId: proto.Uint64(16387), NumOfDiff: proto.Uint32(1),
+		},
+		&pb.SnapshotDiffSection_FileDiff{SnapshotId: proto.Uint32(0), FileSize: proto.Uint64(10), Name: []byte("a")})
+	b.add(t, "SNAPSHOT",
+		&pb.SnapshotSection{SnapshotCounter: proto.Uint32(1), SnapshottableDir: []uint64{16386}, NumSnapshots: proto.Uint32(1)},
+		&pb.SnapshotSection_Snapshot{SnapshotId: proto.Uint32(0), Root: testDir(16386, "s0")})
+	b.add(t, "INODE_REFERENCE", &pb.INodeReferenceSection_INodeReference{
+		ReferredId: proto.Uint64(16388), Name: []byte("old"), DstSnapshotId: proto.Uint32(0), LastSnapshotId: proto.Uint32(0),
+	})
+	b.add(t, "INODE", &pb.INodeSection{LastInodeId: proto.Uint64(16390), NumInodes: proto.Uint64(uint64(len(inodes)))})
+	for _, inode := range inodes {
+		b.add(t, "INODE", inode)
+	}
+	b.addRaw("ERASURE_CODING", nil)
+	b.add(t, "STRING_TABLE", &pb.StringTableSection{NumEntry: proto.Uint32(4)},
+		&pb.StringTableSection_Entry{Id: proto.Uint32(1), Str: proto.String("hdfs")},
+		&pb.StringTableSection_Entry{Id: proto.Uint32(2), Str: proto.String("supergroup")},
+		&pb.StringTableSection_Entry{Id: proto.Uint32(3), Str: proto.String("alice")},
+		&pb.StringTableSection_Entry{Id: proto.Uint32(4), Str: proto.String("tag")})
+	b.add(t, "NS_INFO", &pb.NameSystemSection{
+		NamespaceId: proto.Uint32(1), GenstampV1: proto.Uint64(1000), GenstampV2: proto.Uint64(1001),
+		GenstampV1Limit: proto.Uint64(0), LastAllocatedBlockId: proto.Uint64(1074004018), TransactionId: proto.Uint64(42),
+	})
+
+	var out bytes.Buffer
+	if err := b.open(t).WriteXML(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	dirFields := "<mtime>1505725539089</mtime><permission>hdfs:supergroup:0755</permission><nsquota>-1</nsquota><dsquota>-1</dsquota>"
+	fileFields := "<replication>3</replication><mtime>1505725539089</mtime><atime>1505725539089</atime>" +
+		"<preferredBlockSize>134217728</preferredBlockSize><permission>hdfs:supergroup:0644</permission>"
+	want := "<?xml version=\"1.0\"?>\n<fsimage>" +
+		"<version><layoutVersion>-63</layoutVersion><onDiskVersion>1</onDiskVersion><oivRevision>hdfs-fsimage-dump</oivRevision></version>\n" +
+		"<NameSection><namespaceId>1</namespaceId><genstampV1>1000</genstampV1><genstampV2>1001</genstampV2>" +
+		"<genstampV1Limit>0</genstampV1Limit><lastAllocatedBlockId>1074004018</lastAllocatedBlockId><txid>42</txid></NameSection>\n" +
+		"<ErasureCodingSection></ErasureCodingSection>\n" +
+		"<INodeSection><lastInodeId>16390</lastInodeId><numInodes>5</numInodes>\n" +
+		"<inode><id>16385</id><type>DIRECTORY</type><name></name>" + dirFields + "</inode>\n" +
+		"<inode><id>16386</id><type>DIRECTORY</type><name>dir</name><mtime>1505725539089</mtime><permission>hdfs:supergroup:0755</permission>" +
+		"<xattrs><xattr><ns>USER</ns><name>tag</name><val>v&lt;1&gt;</val></xattr><xattr><ns>TRUSTED</ns><name>tag</name><valHex>ff00</valHex></xattr></xattrs>" +
+		"<acls><acl>user:alice:r-x</acl><acl>default:group::r--</acl></acls><nsquota>-1</nsquota><dsquota>-1</dsquota></inode>\n" +
+		"<inode><id>16387</id><type>FILE</type><name>a&amp;&lt;b&gt;&quot;&apos;\\5c;\\1;</name>" + fileFields +
+		"<blocks><block><id>1074004017</id><genstamp>1001</genstamp><numBytes>10</numBytes></block>\n" +
+		"<block><id>1074004018</id><genstamp>1001</genstamp><numBytes>20</numBytes></block>\n</blocks>\n</inode>\n" +
+		"<inode><id>16389</id><type>SYMLINK</type><name>link</name><permission>hdfs:supergroup:0777</permission>" +
+		"<target>/dir/a&amp;&lt;b&gt;&quot;&apos;\\5c;\\1;</target><mtime>1505725539089</mtime><atime>1505405189045</atime></inode>\n" +
+		"<inode><id>16390</id><type>FILE</type><name>uc</name>" + fileFields +
+		"<file-under-construction><clientName>DFSClient_1</clientName><clientMachine>10.0.0.1</clientMachine></file-under-construction>\n</inode>\n" +
+		"</INodeSection>\n" +
+		"<INodeReferenceSection><ref><referredId>16388</referredId><name>old</name><dstSnapshotId>0</dstSnapshotId><lastSnapshotId>0</lastSnapshotId></ref>\n" +
+		"</INodeReferenceSection>\n" +
+		"<SnapshotSection><snapshotCounter>1</snapshotCounter><numSnapshots>1</numSnapshots><snapshottableDir><dir>16386</dir></snapshottableDir>\n" +
+		"<snapshot><id>0</id><root><id>16386</id><type>DIRECTORY</type><name>s0</name>" + dirFields + "</root></snapshot></SnapshotSection>\n" +
+		"<SnapshotDiffSection><dirDiffEntry><inodeId>16386</inodeId><count>1</count>" +
+		"<dirDiff><snapshotId>0</snapshotId><childrenSize>2</childrenSize><isSnapshotRoot>true</isSnapshotRoot><name>s0</name>" +
+		"<snapshotCopy>" + dirFields + "</snapshotCopy>\n" +
+		"<createdListSize>1</createdListSize><deletedInode>16388</deletedInode><deletedInoderef>0</deletedInoderef>" +
+		"<created><name>uc</name></created>\n</dirDiff>\n</dirDiffEntry>\n" +
+		"<fileDiffEntry><inodeId>16387</inodeId><count>1</count>" +
+		"<fileDiff><snapshotId>0</snapshotId><size>10</size><name>a</name></fileDiff>\n</fileDiffEntry>\n" +
+		"</SnapshotDiffSection>\n" +
+		"<INodeDirectorySection><directory><parent>16385</parent><child>16386</child><child>16389</child></directory>\n" +
+		"<directory><parent>16386</parent><child>16387</child><child>16390</child><refChild>0</refChild></directory>\n" +
+		"</INodeDirectorySection>\n" +
+		"<FileUnderConstructionSection><inode><id>16390</id><path>/dir/uc</path></inode>\n</FileUnderConstructionSection>\n" +
+		"<SecretManagerSection><currentId>2</currentId><tokenSequenceNumber>7</tokenSequenceNumber>" +
+		"<delegationKeys><delegationKey><id>2</id><key>dead</key><expiry>2017-09-18T09:05:39.089</expiry></delegationKey></delegationKeys>" +
+		"<tokens><token><version>0</version><owner>alice</owner><renewer>yarn</renewer><realUser></realUser>" +
+		"<issueDate>2017-09-18T09:05:39.089</issueDate><maxDate>2017-09-25T09:05:39.089</maxDate><sequenceNumber>7</sequenceNumber>" +
+		"<masterKeyId>2</masterKeyId><expiryDate>2017-09-19T09:05:39.089</expiryDate></token></tokens></SecretManagerSection>\n" +
+		"<CacheManagerSection><nextDirectiveId>3</nextDirectiveId><numDirectives>1</numDirectives><numPools>1</numPools>" +
+		"<pool><poolName>pool1</poolName><ownerName>hdfs</ownerName><groupName>supergroup</groupName><mode>493</mode>" +
+		"<limit>1000</limit><maxRelativeExpiry>2305843009213693951</maxRelativeExpiry></pool>\n" +
+		"<directive><id>2</id><path>/data</path><replication>2</replication><pool>pool1</pool>" +
+		"<expiration><millis>86400000</millis><relative>true</relative></expiration>\n</directive>\n" +
+		"</CacheManagerSection>\n" +
+		"</fsimage>\n"
+
+	if got := out.String(); got != want {
+		gotLines, wantLines := strings.SplitAfter(got, "\n"), strings.SplitAfter(want, "\n")
+		for i := range wantLines {
+			if i >= len(gotLines) || gotLines[i] != wantLines[i] {
+				t.Fatalf("line %d:\n%s\nwant\n%s", i+1, strings.Join(gotLines[i:], ""), wantLines[i])
+			}
+		}
+		t.Fatalf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestAppendXMLString(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{"", ""},
+		{"plain/path_1.txt", "plain/path_1.txt"},
+		{`a&b"c'd<e>f`, "a&amp;b&quot;c&apos;d&lt;e&gt;f"},
+		{`C:\dir`, `C:\5c;dir`},
+		{"\x00\x01\x1b\x1f", `\0;\1;\1b;\1f;`},
+		{"tab\tlf\ncr\r", "tab\tlf\ncr\r"},
+		{"\x7f", "\x7f"},
+		{"\ufffe\uffff\ufffd", `\fffe;\ffff;` + "\ufffd"},
+		{"caf\u00e9 \u65e5\u672c \U0001f600", "caf\u00e9 \u65e5\u672c \U0001f600"},
+		{"bad\xffutf8", "bad\ufffdutf8"},
+	}
+
+	for _, tt := range tests {
+		if got := string(appendXMLString(nil, tt.s)); got != tt.want {
+			t.Errorf("%q: %q, want %q", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestWriteXMLErasureCoding(t *testing.T) {
+	rs := wireBytes(1,
+		wireBytes(1, []byte("RS-6-3-1024k")),
+		wireBytes(2, wireBytes(1, []byte("rs")), wireVarint(2, 6), wireVarint(3, 3)),
+		wireVarint(3, 1048576),
+		wireVarint(4, 1),
+	)
+	user := wireBytes(1,
+		wireBytes(1, []byte("XOR-2-1-128k")),
+		wireBytes(2, wireBytes(1, []byte("xor")), wireVarint(2, 2), wireVarint(3, 1),
+			wireBytes(4, wireBytes(1, []byte("k1")), wireBytes(2, []byte("v1"))),
+			wireBytes(4, wireBytes(1, []byte("k2")), wireBytes(2, []byte("a<b")))),
+		wireVarint(3, 131072),
+		wireVarint(4, 64),
+		wireVarint(5, 1),
+	)
+
+	tests := []struct {
+		name    string
+		section []byte
+		want    string
+	}{
+		{"policies", append(rs, user...), "<ErasureCodingSection>" +
+			"<erasureCodingPolicy><policyId>1</policyId><policyName>RS-6-3-1024k</policyName><cellSize>1048576</cellSize><policyState>ENABLED</policyState>" +
+			"<ecSchema><codecName>rs</codecName><dataUnits>6</dataUnits><parityUnits>3</parityUnits></ecSchema></erasureCodingPolicy>\n" +
+			"<erasureCodingPolicy><policyId>64</policyId><policyName>XOR-2-1-128k</policyName><cellSize>131072</cellSize><policyState>DISABLED</policyState>" +
+			"<ecSchema><codecName>xor</codecName><dataUnits>2</dataUnits><parityUnits>1</parityUnits>" +
+			"<extraOptions><option><key>k1</key><value>v1</value></option><option><key>k2</key><value>a&lt;b</value></option></extraOptions>" +
+			"</ecSchema></erasureCodingPolicy>\n" +
+			"</ErasureCodingSection>\n"},
+		{"no policies", nil, "<ErasureCodingSection></ErasureCodingSection>\n"},
+	}
+
+	for _, tt := range tests {
+		b := newTestImage()
+		b.addRaw("ERASURE_CODING", tt.section)
+		var out bytes.Buffer
+		if err := b.open(t).WriteXML(&out); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		got := out.String()
+		got = got[strings.Index(got, "</version>\n")+len("</version>\n") : strings.Index(got, "</fsimage>")]
+		if !strings.HasPrefix(got, tt.want) {
+			t.Errorf("%s:\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+
+	b := newTestImage()
+	b.addRaw("ERASURE_CODING", wireBytes(1, []byte{0x0a, 5}))
+	if err := b.open(t).WriteXML(&bytes.Buffer{}); err != ErrorBrokenSection {
+		t.Errorf("broken policy: %v", err)
+	}
+}
+
+func TestWriteXMLQuota(t *testing.T) {
+	noQuota := testDir(16386, "a")
+	noQuota.Directory.NsQuota = nil
+	noQuota.Directory.DsQuota = nil
+	nsQuota := testDir(16387, "b")
+	nsQuota.Directory.NsQuota = proto.Uint64(100)
+	nsQuota.Directory.DsQuota = nil
+
+	b := newTestImage()
+	b.addTree(t, []*pb.INodeSection_INode{testDir(RootInodeID, ""), noQuota, nsQuota},
+		map[uint64][]uint64{RootInodeID: {16386, 16387}})
+	var out bytes.Buffer
+	if err := b.open(t).WriteXML(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"<name></name><mtime>1505725539089</mtime><permission>hdfs:supergroup:0755</permission><nsquota>-1</nsquota><dsquota>-1</dsquota>",
+		"<name>a</name><mtime>1505725539089</mtime><permission>hdfs:supergroup:0755</permission><nsquota>0</nsquota><dsquota>0</dsquota>",
+		"<name>b</name><mtime>1505725539089</mtime><permission>hdfs:supergroup:0755</permission><nsquota>100</nsquota><dsquota>0</dsquota>",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("no %s in\n%s", want, out.String())
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/lomik/hdfs-fsimage-dump/fsimage"
+)
+
+// imageInfo returns the FileSummary and NS_INFO metadata of an image
+func imageInfo(img *fsimage.Image) (map[string]interface{}, error) {
+	nameSystem, err := img.ReadNameSystem()
+	if err != nil {
+		return nil, err
+	}
+
+	sections := make([]map[string]interface{}, 0, len(img.Summary.GetSections()))
+	for _, s := range img.Summary.GetSections() {
+		sections = append(sections, map[string]interface{}{
+			"Name":   s.GetName(),
+			"Offset": s.GetOffset(),
+			"Length": s.GetLength(),
+		})
+	}
+
+	return map[string]interface{}{
+		"LayoutVersion":           int32(img.Summary.GetLayoutVersion()),
+		"OndiskVersion":           img.Summary.GetOndiskVersion(),
+		"Codec":                   img.Codec,
+		"NamespaceId":             nameSystem.GetNamespaceId(),
+		"GenstampV1":              nameSystem.GetGenstampV1(),
+		"GenstampV2":              nameSystem.GetGenstampV2(),
+		"GenstampV1Limit":         nameSystem.GetGenstampV1Limit(),
+		"LastAllocatedBlockId":    nameSystem.GetLastAllocatedBlockId(),
+		"TransactionId":           nameSystem.GetTransactionId(),
+		"RollingUpgradeStartTime": nameSystem.GetRollingUpgradeStartTime(),
+		"Sections":                sections,
+	}, nil
+}
+
+// headerRecord returns the first json record of -header, the imageInfo
+// metadata with Header set to tell it from inode records
+func headerRecord(img *fsimage.Image) (map[string]interface{}, error) {
+	info, err := imageInfo(img)
+	if err != nil {
+		return nil, err
+	}
+	info["Header"] = true
+	return info, nil
+}
+
+// infoCommand prints the metadata of an image as json
+func infoCommand(args []string) {
+	flags := flag.NewFlagSet("info", flag.ExitOnError)
+	fileName := flags.String("i", "", "[mandatory]: HDFS fsimage filename")
+	flags.Parse(args)
+
+	if *fileName == "" {
+		flags.PrintDefaults()
+		os.Exit(2)
+	}
+
+	img, err := fsimage.Open(*fileName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer img.Close()
+
+	info, err := imageInfo(img)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = json.NewEncoder(os.Stdout).Encode(info); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/lomik/hdfs-fsimage-dump/pb/hadoop_hdfs_fsimage"
+)
+
+// encodeJSON returns v as a json line without the newline
+func encodeJSON(t *testing.T, v interface{}) string {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestImageInfo(t *testing.T) {
+	nsInfo := testFrames(t, &pb.NameSystemSection{
+		NamespaceId:             proto.Uint32(1234567),
+		GenstampV1:              proto.Uint64(1000),
+		GenstampV2:              proto.Uint64(1005),
+		GenstampV1Limit:         proto.Uint64(0),
+		LastAllocatedBlockId:    proto.Uint64(1073741830),
+		TransactionId:           proto.Uint64(42),
+		RollingUpgradeStartTime: proto.Uint64(1505725539089),
+	})
+	stringTable := testFrames(t, &pb.StringTableSection{NumEntry: proto.Uint32(0)})
+
+	tests := []struct {
+		codec string
+	}{
+		{""},
+		{"org.apache.hadoop.io.compress.DefaultCodec"},
+	}
+
+	for _, tt := range tests {
+		img := testImage(t, tt.codec, testSection{"NS_INFO", nsInfo}, testSection{"STRING_TABLE", stringTable})
+		s := img.Summary.GetSections()
+		want := fmt.Sprintf(`{"Codec":%q,"GenstampV1":1000,"GenstampV1Limit":0,"GenstampV2":1005,`+
+			`"LastAllocatedBlockId":1073741830,"LayoutVersion":-63,"NamespaceId":1234567,"OndiskVersion":1,`+
+			`"RollingUpgradeStartTime":1505725539089,"Sections":[`+
+			`{"Length":%d,"Name":"NS_INFO","Offset":8},{"Length":%d,"Name":"STRING_TABLE","Offset":%d}],"TransactionId":42}`,
+			tt.codec, s[0].GetLength(), s[1].GetLength(), 8+s[0].GetLength())
+
+		info, err := imageInfo(img)
+		if err != nil {
+			t.Fatalf("codec %q: %v", tt.codec, err)
+		}
+		if got := encodeJSON(t, info); got != want {
+			t.Errorf("codec %q: info\n%s\nwant\n%s", tt.codec, got, want)
+		}
+
+		// the -header record is the info with Header set
+		header, err := headerRecord(img)
+		if err != nil {
+			t.Fatalf("codec %q: %v", tt.codec, err)
+		}
+		if header["Header"] != true {
+			t.Errorf("codec %q: header %v", tt.codec, header["Header"])
+		}
+		delete(header, "Header")
+		if got := encodeJSON(t, header); got != want {
+			t.Errorf("codec %q: header\n%s\nwant\n%s", tt.codec, got, want)
+		}
+	}
+
+	img := testImage(t, "", testSection{"STRING_TABLE", stringTable})
+	if _, err := imageInfo(img); err == nil {
+		t.Error("no error without NS_INFO")
+	}
+	if _, err := headerRecord(img); err == nil {
+		t.Error("no header error without NS_INFO")
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/lomik/hdfs-fsimage-dump/fsimage"
+)
+
+// inspectCommand prints a json line per section of the FileSummary with its
+// frames, for images which fail to parse
+func inspectCommand(args []string) {
+	flags := flag.NewFlagSet("inspect", flag.ExitOnError)
+	fileName := flags.String("i", "", "[mandatory]: HDFS fsimage filename")
+	maxFrameSize := flags.Int64("max-frame-size", fsimage.DefaultMaxFrameSize, "[optional]: max size of one fsimage frame in bytes, larger frames are reported as broken")
+	flags.Parse(args)
+
+	if *fileName == "" {
+		flags.PrintDefaults()
+		os.Exit(2)
+	}
+
+	img, err := fsimage.Open(*fileName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer img.Close()
+	img.MaxFrameSize = *maxFrameSize
+
+	jsonEncoder := json.NewEncoder(os.Stdout)
+	for _, st := range img.InspectSections() {
+		if err = jsonEncoder.Encode(inspectLine(st)); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// inspectLine returns the json line of a section, Ratio is the decompressed
+// size of the frames read to the length in the file
+func inspectLine(st fsimage.SectionStats) map[string]interface{} {
+	line := map[string]interface{}{
+		"Name":     st.Name,
+		"Offset":   st.Offset,
+		"Length":   st.Length,
+		"Size":     st.Size,
+		"Frames":   st.Frames,
+		"MaxFrame": st.MaxFrame,
+		"Known":    st.Known,
+		"Read":     st.Read,
+	}
+	if st.Length > 0 {
+		line["Ratio"] = float64(st.Size) / float64(st.Length)
+	}
+	if st.Err != nil {
+		line["Error"] = st.Err.Error()
+	}
+	return line
+}
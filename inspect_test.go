@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/lomik/hdfs-fsimage-dump/fsimage"
+	pb "github.com/lomik/hdfs-fsimage-dump/pb/hadoop_hdfs_fsimage"
+)
+
+func TestInspectLine(t *testing.T) {
+	frames := testFrames(t,
+		&pb.StringTableSection{NumEntry: proto.Uint32(1)},
+		&pb.StringTableSection_Entry{Id: proto.Uint32(1), Str: proto.String(strings.Repeat("a", 82))})
+
+	for _, codec := range []string{"", "org.apache.hadoop.io.compress.DefaultCodec"} {
+		img := testImage(t, codec, testSection{"STRING_TABLE", frames}, testSection{"X_PLUGIN", nil})
+		length := img.Summary.GetSections()[0].GetLength()
+		want := map[string]interface{}{
+			"Name": "STRING_TABLE", "Offset": 8, "Length": length, "Size": 90, "Frames": 2, "MaxFrame": 86,
+			"Known": true, "Read": true, "Ratio": 90 / float64(length),
+		}
+		if codec != "" && length >= 90 {
+			t.Errorf("codec %q: length %d is not compressed", codec, length)
+		}
+
+		stats := img.InspectSections()
+		if got, want := encodeJSON(t, inspectLine(stats[0])), encodeJSON(t, want); got != want {
+			t.Errorf("codec %q:\n%s\nwant\n%s", codec, got, want)
+		}
+		want = map[string]interface{}{
+			"Name": "X_PLUGIN", "Offset": 8 + length, "Length": 0, "Size": 0, "Frames": 0, "MaxFrame": 0,
+			"Known": false, "Read": false,
+		}
+		if codec != "" {
+			// an empty zlib stream
+			want["Length"] = img.Summary.GetSections()[1].GetLength()
+			want["Ratio"] = 0.0
+		}
+		if got, want := encodeJSON(t, inspectLine(stats[1])), encodeJSON(t, want); got != want {
+			t.Errorf("codec %q:\n%s\nwant\n%s", codec, got, want)
+		}
+	}
+
+	// an error is a string
+	st := fsimage.SectionStats{Name: "INODE", Offset: 100, Length: 10, Size: 5, Frames: 1, MaxFrame: 4, Known: true, Read: true, Err: fsimage.ErrorBrokenSection}
+	want := `{"Error":"` + fsimage.ErrorBrokenSection.Error() + `","Frames":1,"Known":true,"Length":10,"MaxFrame":4,"Name":"INODE","Offset":100,"Ratio":0.5,"Read":true,"Size":5}`
+	if got := encodeJSON(t, inspectLine(st)); got != want {
+		t.Errorf("broken section:\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,124 @@
+// Package lz4 decompresses raw LZ4 blocks, the chunks of Hadoop Lz4Codec.
+package lz4
+
+import "errors"
+
+var (
+	ErrInputOverrun      = errors.New("lz4: input overrun")
+	ErrOutputOverrun     = errors.New("lz4: output overrun")
+	ErrLookbehindOverrun = errors.New("lz4: lookbehind overrun")
+	ErrDataCorrupted     = errors.New("lz4: data corrupted")
+)
+
+const minMatch = 4
+
+// Decompress decompresses an LZ4 block from src into dst and returns the
+// decompressed length. Like LZ4_decompress_safe it never reads or writes out
+// of bounds and fails on corrupted input.
+func Decompress(src []byte, dst []byte) (int, error) {
+	return decompress(src, dst, false)
+}
+
+// DecodedLen returns the decompressed length of an LZ4 block. It only parses
+// the sequences, so it is much faster than Decompress.
+func DecodedLen(src []byte) (int, error) {
+	return decompress(src, nil, true)
+}
+
+// decompress decompresses src into dst, or only counts the output if count is set
+func decompress(src []byte, dst []byte, count bool) (int, error) {
+	ip, op := 0, 0
+
+	if len(src) == 0 {
+		return 0, ErrInputOverrun
+	}
+
+	for {
+		token := int(src[ip])
+		ip++
+
+		// literals
+		length := token >> 4
+		if length == 15 {
+			var err error
+			if length, ip, err = extendLength(src, ip, length); err != nil {
+				return op, err
+			}
+		}
+		if ip+length > len(src) {
+			return op, ErrInputOverrun
+		}
+		if !count {
+			if op+length > len(dst) {
+				return op, ErrOutputOverrun
+			}
+			copy(dst[op:op+length], src[ip:ip+length])
+		}
+		ip += length
+		op += length
+
+		// the last sequence has only literals
+		if ip == len(src) {
+			return op, nil
+		}
+
+		// match
+		if ip+2 > len(src) {
+			return op, ErrInputOverrun
+		}
+		offset := int(src[ip]) | int(src[ip+1])<<8
+		ip += 2
+		if offset == 0 {
+			return op, ErrDataCorrupted
+		}
+		mPos := op - offset
+		if mPos < 0 {
+			return op, ErrLookbehindOverrun
+		}
+		length = token & 15
+		if length == 15 {
+			var err error
+			if length, ip, err = extendLength(src, ip, length); err != nil {
+				return op, err
+			}
+		}
+		length += minMatch
+		if count {
+			op += length
+		} else if op+length > len(dst) {
+			return op, ErrOutputOverrun
+		} else if offset >= length {
+			copy(dst[op:op+length], dst[mPos:mPos+length])
+			op += length
+		} else {
+			// overlapping match repeats the last bytes
+			for i := 0; i < length; i++ {
+				dst[op] = dst[mPos]
+				op++
+				mPos++
+			}
+		}
+
+		if ip >= len(src) {
+			return op, ErrInputOverrun
+		}
+	}
+}
+
+// extendLength adds bytes to a length until a byte is not 255
+func extendLength(src []byte, ip int, length int) (int, int, error) {
+	for {
+		if ip >= len(src) {
+			return length, ip, ErrInputOverrun
+		}
+		b := int(src[ip])
+		ip++
+		length += b
+		if length > len(src)*255 {
+			return length, ip, ErrDataCorrupted
+		}
+		if b != 255 {
+			return length, ip, nil
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package lz4
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"testing"
+)
+
+type fixture struct {
+	name string
+	src  []byte
+	want []byte
+}
+
+// fixtures are the blocks of the LZ4 compressors in testdata, see
+// testdata/gen.go: literals only, literals with 255 byte length extensions,
+// overlapping matches of distance 1 and 3 with 255 byte length extensions
+// and text
+func fixtures(t *testing.T) []fixture {
+	fields, err := ioutil.ReadFile("../lzo/testdata/fields.c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	random := make([]byte, 1000)
+	rand.New(rand.NewSource(1)).Read(random)
+
+	inputs := []struct {
+		name string
+		data []byte
+	}{
+		{"hello", []byte("hello, world\n")},
+		{"random", random},
+		{"aaa", bytes.Repeat([]byte("a"), 1000)},
+		{"abc", bytes.Repeat([]byte("abc"), 400)},
+		{"fields.c", fields},
+	}
+
+	var all []fixture
+	for _, in := range inputs {
+		for _, compressor := range []string{"lz4", "lz4hc"} {
+			src, err := ioutil.ReadFile(filepath.Join("testdata", in.name+"."+compressor))
+			if err != nil {
+				t.Fatal(err)
+			}
+			all = append(all, fixture{in.name + " " + compressor, src, in.data})
+		}
+	}
+	return all
+}
+
+func TestDecompress(t *testing.T) {
+	for _, f := range fixtures(t) {
+		if n, err := DecodedLen(f.src); err != nil || n != len(f.want) {
+			t.Errorf("%s: DecodedLen = %d, %v, want %d", f.name, n, err, len(f.want))
+		}
+		// the output buffer may be larger than the output
+		for _, size := range []int{len(f.want), len(f.want) + 10} {
+			dst := make([]byte, size)
+			n, err := Decompress(f.src, dst)
+			if err != nil {
+				t.Errorf("%s into %d bytes: %v", f.name, size, err)
+				continue
+			}
+			if !bytes.Equal(dst[:n], f.want) {
+				t.Errorf("%s into %d bytes: %d bytes differ from %d", f.name, size, n, len(f.want))
+			}
+		}
+	}
+}
+
+func TestDecompressErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  []byte
+		dst  int
+		err  error
+	}{
+		{"empty", nil, 10, ErrInputOverrun},
+		{"truncated literals", []byte{0x50, 'a', 'b'}, 10, ErrInputOverrun},
+		{"truncated literal length", []byte{0xf0, 255, 255}, 1000, ErrInputOverrun},
+		{"truncated offset", []byte{0x10, 'a', 1}, 10, ErrInputOverrun},
+		{"truncated match length", []byte{0x1f, 'a', 1, 0, 255}, 1000, ErrInputOverrun},
+		{"no last literals", []byte{0x10, 'a', 1, 0}, 10, ErrInputOverrun},
+		{"offset 0", []byte{0x10, 'a', 0, 0, 0x10, 'b'}, 10, ErrDataCorrupted},
+		{"match before the output", []byte{0x10, 'a', 2, 0, 0x10, 'b'}, 10, ErrLookbehindOverrun},
+		{"literals over the output", []byte{0x50, 'h', 'e', 'l', 'l', 'o'}, 4, ErrOutputOverrun},
+		{"match over the output", []byte{0x10, 'a', 1, 0, 0x10, 'b'}, 4, ErrOutputOverrun},
+	}
+
+	for _, tt := range tests {
+		if _, err := Decompress(tt.src, make([]byte, tt.dst)); err != tt.err {
+			t.Errorf("%s: Decompress error %v, want %v", tt.name, err, tt.err)
+		}
+		if tt.err == ErrOutputOverrun {
+			continue
+		}
+		if _, err := DecodedLen(tt.src); err != tt.err {
+			t.Errorf("%s: DecodedLen error %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestDecompressTruncated(t *testing.T) {
+	for _, f := range fixtures(t) {
+		dst := make([]byte, len(f.want))
+		// a block cut after the literals of a sequence is valid, but shorter
+		step := 1 + len(f.src)/512
+		for i := 0; i < len(f.src); i += step {
+			if n, err := Decompress(f.src[:i], dst); err == nil && n == len(f.want) {
+				t.Errorf("%s: no Decompress error for %d of %d bytes", f.name, i, len(f.src))
+			}
+			if n, err := DecodedLen(f.src[:i]); err == nil && n == len(f.want) {
+				t.Errorf("%s: no DecodedLen error for %d of %d bytes", f.name, i, len(f.src))
+			}
+		}
+	}
+}
+
+func TestDecompressCorrupt(t *testing.T) {
+	for _, f := range fixtures(t) {
+		src := make([]byte, len(f.src))
+		dst := make([]byte, len(f.want)+64)
+		step := 1 + len(f.src)/512
+		for i := 0; i < len(f.src); i += step {
+			for _, x := range []byte{0x01, 0x10, 0x80, 0xff} {
+				copy(src, f.src)
+				src[i] ^= x
+				// must not panic, the output stays in dst and the
+				// length agrees with the output
+				n, err := Decompress(src, dst)
+				if n < 0 || n > len(dst) {
+					t.Fatalf("%s: byte %d ^ %#x: length %d", f.name, i, x, n)
+				}
+				if size, sizeErr := DecodedLen(src); err == nil && (sizeErr != nil || size != n) {
+					t.Errorf("%s: byte %d ^ %#x: DecodedLen = %d, %v, Decompress = %d", f.name, i, x, size, sizeErr, n)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,53 @@
+//go:build ignore
+
+// gen writes the LZ4 fixtures of the tests with the lz4.c and lz4hc.c of the
+// LZ4 library bundled in github.com/cloudflare/golz4. The inputs are those of
+// inputs in lz4_test.go.
+//
+//	go run gen.go
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"math/rand"
+
+	lz4 "github.com/cloudflare/golz4"
+)
+
+func main() {
+	fields, err := ioutil.ReadFile("../../lzo/testdata/fields.c")
+	if err != nil {
+		log.Fatal(err)
+	}
+	random := make([]byte, 1000)
+	rand.New(rand.NewSource(1)).Read(random)
+
+	inputs := map[string][]byte{
+		"hello":    []byte("hello, world\n"),
+		"random":   random,
+		"aaa":      bytes.Repeat([]byte("a"), 1000),
+		"abc":      bytes.Repeat([]byte("abc"), 400),
+		"fields.c": fields,
+	}
+	for name, data := range inputs {
+		out := make([]byte, lz4.CompressBound(data))
+		n, err := lz4.Compress(data, out)
+		if err != nil {
+			log.Fatal(err)
+		}
+		write(name+".lz4", out[:n])
+
+		if n, err = lz4.CompressHC(data, out); err != nil {
+			log.Fatal(err)
+		}
+		write(name+".lz4hc", out[:n])
+	}
+}
+
+func write(name string, data []byte) {
+	if err := ioutil.WriteFile(name, data, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
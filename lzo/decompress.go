@@ -0,0 +1,222 @@
+// Package lzo decompresses LZO1X blocks and lzop streams in pure Go. The
+// cgolzo build tag switches block decompression to liblzo2.
+package lzo
+
+import "errors"
+
+var (
+	ErrInputOverrun      = errors.New("lzo: input overrun")
+	ErrOutputOverrun     = errors.New("lzo: output overrun")
+	ErrLookbehindOverrun = errors.New("lzo: lookbehind overrun")
+	ErrInputNotConsumed  = errors.New("lzo: input not consumed")
+	ErrDataCorrupted     = errors.New("lzo: data corrupted")
+)
+
+const (
+	m2MaxOffset = 0x0800
+	// limit of zero bytes in a length, as in lzo1x_decompress_safe
+	max255Count = (^uint(0))/255 - 2
+)
+
+// Decompress1X decompresses an LZO1X block from src into dst and returns the
+// decompressed length. Like lzo1x_decompress_safe it never reads or writes
+// out of bounds and fails on corrupted input.
+func Decompress1X(src []byte, dst []byte) (int, error) {
+	return decompress1X(src, dst, false)
+}
+
+// DecodedLen1X returns the decompressed length of an LZO1X block. It only
+// parses the instructions, so it is much faster than Decompress1X.
+func DecodedLen1X(src []byte) (int, error) {
+	return decompress1X(src, nil, true)
+}
+
+// decompress1X decompresses src into dst, or only counts the output if count is set
+func decompress1X(src []byte, dst []byte, count bool) (int, error) {
+	ip, op := 0, 0
+	state := 0
+
+	if len(src) == 0 {
+		return 0, ErrInputOverrun
+	}
+
+	// the first byte may start with a literal run
+	if src[0] > 17 {
+		t := int(src[0]) - 17
+		ip++
+		if ip+t > len(src) {
+			return op, ErrInputOverrun
+		}
+		if !count {
+			if op+t > len(dst) {
+				return op, ErrOutputOverrun
+			}
+			copy(dst[op:op+t], src[ip:ip+t])
+		}
+		ip += t
+		op += t
+		if t < 4 {
+			state = t
+		} else {
+			state = 4
+		}
+	}
+
+	for {
+		if ip >= len(src) {
+			return op, ErrInputOverrun
+		}
+		t := int(src[ip])
+		ip++
+
+		var mPos, length, next int
+
+		if t < 16 {
+			if state == 0 {
+				// literal run
+				if t == 0 {
+					var err error
+					if t, ip, err = extendLength(src, ip, 15); err != nil {
+						return op, err
+					}
+				}
+				t += 3
+				if ip+t > len(src) {
+					return op, ErrInputOverrun
+				}
+				if !count {
+					if op+t > len(dst) {
+						return op, ErrOutputOverrun
+					}
+					copy(dst[op:op+t], src[ip:ip+t])
+				}
+				ip += t
+				op += t
+				state = 4
+				continue
+			}
+			if ip >= len(src) {
+				return op, ErrInputOverrun
+			}
+			next = t & 3
+			if state != 4 {
+				// 2 byte match right after short literals
+				mPos = op - 1 - t>>2 - int(src[ip])<<2
+				length = 2
+			} else {
+				// 3 byte match after a literal run
+				mPos = op - (1 + m2MaxOffset) - t>>2 - int(src[ip])<<2
+				length = 3
+			}
+			ip++
+		} else if t >= 64 {
+			// M2: distance up to 2048, length 3..8
+			if ip >= len(src) {
+				return op, ErrInputOverrun
+			}
+			next = t & 3
+			mPos = op - 1 - (t>>2)&7 - int(src[ip])<<3
+			ip++
+			length = t>>5 - 1 + 2
+		} else if t >= 32 {
+			// M3: distance up to 16384
+			length = t&31 + 2
+			if length == 2 {
+				var err error
+				if length, ip, err = extendLength(src, ip, 31); err != nil {
+					return op, err
+				}
+				length += 2
+			}
+			if ip+2 > len(src) {
+				return op, ErrInputOverrun
+			}
+			v := int(src[ip]) | int(src[ip+1])<<8
+			ip += 2
+			mPos = op - 1 - v>>2
+			next = v & 3
+		} else {
+			// M4: distance up to 49151 or the end of stream
+			mPos = op - (t&8)<<11
+			length = t&7 + 2
+			if length == 2 {
+				var err error
+				if length, ip, err = extendLength(src, ip, 7); err != nil {
+					return op, err
+				}
+				length += 2
+			}
+			if ip+2 > len(src) {
+				return op, ErrInputOverrun
+			}
+			v := int(src[ip]) | int(src[ip+1])<<8
+			ip += 2
+			mPos -= v >> 2
+			next = v & 3
+			if mPos == op {
+				if length != 3 {
+					return op, ErrDataCorrupted
+				}
+				if ip < len(src) {
+					return op, ErrInputNotConsumed
+				}
+				return op, nil
+			}
+			mPos -= 0x4000
+		}
+
+		if mPos < 0 {
+			return op, ErrLookbehindOverrun
+		}
+		if count {
+			op += length
+		} else if op+length > len(dst) {
+			return op, ErrOutputOverrun
+		} else if op-mPos >= length {
+			copy(dst[op:op+length], dst[mPos:mPos+length])
+			op += length
+		} else {
+			// overlapping match repeats the last bytes
+			for i := 0; i < length; i++ {
+				dst[op] = dst[mPos]
+				op++
+				mPos++
+			}
+		}
+
+		// up to 3 literals after a match
+		state = next
+		if next > 0 {
+			if ip+next > len(src) {
+				return op, ErrInputOverrun
+			}
+			if !count {
+				if op+next > len(dst) {
+					return op, ErrOutputOverrun
+				}
+				copy(dst[op:op+next], src[ip:ip+next])
+			}
+			ip += next
+			op += next
+		}
+	}
+}
+
+// extendLength reads a length stored as zero bytes, each worth 255, and a
+// final non zero byte. base is added to the result.
+func extendLength(src []byte, ip int, base int) (int, int, error) {
+	start := ip
+	for ip < len(src) && src[ip] == 0 {
+		ip++
+	}
+	if ip >= len(src) {
+		return 0, ip, ErrInputOverrun
+	}
+	zeros := uint(ip - start)
+	if zeros > max255Count {
+		return 0, ip, ErrDataCorrupted
+	}
+	t := int(zeros)*255 + base + int(src[ip])
+	ip++
+	return t, ip, nil
+}
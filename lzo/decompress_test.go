@@ -0,0 +1,230 @@
+package lzo
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// end is the end of stream marker, an M4 match of distance 0
+var end = []byte{0x11, 0x00, 0x00}
+
+// lit returns n bytes without short repeats
+func lit(n int, seed byte) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i*7) + seed ^ byte(i>>8)
+	}
+	return b
+}
+
+// match appends n bytes copied from dist bytes back one by one, so the
+// copy may overlap its own output
+func match(out []byte, dist, n int) []byte {
+	for i := 0; i < n; i++ {
+		out = append(out, out[len(out)-dist])
+	}
+	return out
+}
+
+// le16 returns the distance bytes of M3 and M4
+func le16(v int) []byte {
+	return []byte{byte(v), byte(v >> 8)}
+}
+
+func cat(parts ...[]byte) []byte {
+	var b []byte
+	for _, p := range parts {
+		b = append(b, p...)
+	}
+	return b
+}
+
+type fixture struct {
+	name string
+	src  []byte
+	want []byte
+}
+
+// fixtures are LZO1X streams assembled by instruction, the comments give
+// the instruction with its length and distance
+func fixtures() []fixture {
+	l2100 := lit(2100, 1)
+	l300 := lit(300, 5)
+	l40000 := lit(40000, 3)
+
+	return []fixture{
+		{
+			"first literal run",
+			// 3 literals in the first byte
+			cat([]byte{17 + 3}, []byte("abc"), end),
+			[]byte("abc"),
+		},
+		{
+			"M2",
+			// 8 literals, M2 length 4 distance 8
+			cat([]byte{17 + 8}, []byte("abcdefgh"), []byte{3<<5 | 7<<2, 0}, end),
+			[]byte("abcdefghabcd"),
+		},
+		{
+			"M2 overlapping",
+			// 1 literal, M2 length 8 distance 1
+			cat([]byte{17 + 1}, []byte("a"), []byte{7 << 5, 0}, end),
+			[]byte("aaaaaaaaa"),
+		},
+		{
+			"M1 after short literals",
+			// 3 literals, M1 length 2 distance 3 with 1 trailing literal
+			cat([]byte{17 + 3}, []byte("xyz"), []byte{2<<2 | 1, 0}, []byte("q"), end),
+			[]byte("xyzxyq"),
+		},
+		{
+			"M1 after a literal run",
+			// 2100 literals with 8 zero bytes of length, M1 length 3
+			// distance 2049 with 2 trailing literals
+			cat([]byte{0}, make([]byte, 8), []byte{2100 - 18 - 8*255}, l2100, []byte{0 | 2, 0}, []byte("!!"), end),
+			cat(match(cat(l2100), 2049, 3), []byte("!!")),
+		},
+		{
+			"M3",
+			// 10 literals, M3 length 4 distance 10 with 3 trailing literals,
+			// M3 length 300 distance 10 with 1 zero byte of length
+			cat([]byte{17 + 10}, []byte("0123456789"), []byte{32 | (4 - 2), 9<<2 | 3, 0}, []byte("XYZ"), []byte{32, 0, 300 - 33 - 255, 9 << 2, 0}, end),
+			match(cat(match([]byte("0123456789"), 10, 4), []byte("XYZ")), 10, 300),
+		},
+		{
+			"M4",
+			// 40000 literals, M4 length 5 distance 35000, M4 length 20
+			// distance 17000
+			cat([]byte{0}, make([]byte, 156), []byte{40000 - 18 - 156*255}, l40000,
+				[]byte{16 | 8 | (5 - 2)}, le16((35000-0x8000)<<2),
+				[]byte{16, 20 - 9}, le16((17000-0x4000)<<2), end),
+			match(match(cat(l40000), 35000, 5), 17000, 20),
+		},
+		{
+			"long literal run after a match",
+			// 4 literals, M2 length 3 distance 4, 300 literals with 1 zero
+			// byte of length
+			cat([]byte{17 + 4}, []byte("abcd"), []byte{2<<5 | 3<<2, 0}, []byte{0, 0, 300 - 18 - 255}, l300, end),
+			cat([]byte("abcdabc"), l300),
+		},
+	}
+}
+
+// allFixtures adds the output of the lzo1x_1 and lzo1x_999 compressors in
+// testdata, see testdata/gen.go, to fixtures
+func allFixtures(t *testing.T) []fixture {
+	inputs := map[string][]byte{"aaa": bytes.Repeat([]byte("a"), 100000)}
+	for _, name := range []string{"fields.c", "sum", "random.txt"} {
+		data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		inputs[name] = data
+	}
+
+	all := fixtures()
+	for _, name := range []string{"aaa", "fields.c", "sum", "random.txt"} {
+		for _, compressor := range []string{"lzo1x_1", "lzo1x_999"} {
+			src, err := ioutil.ReadFile(filepath.Join("testdata", name+"."+compressor))
+			if err != nil {
+				t.Fatal(err)
+			}
+			all = append(all, fixture{name + " " + compressor, src, inputs[name]})
+		}
+	}
+	return all
+}
+
+func TestDecompress1X(t *testing.T) {
+	for _, f := range allFixtures(t) {
+		t.Run(f.name, func(t *testing.T) {
+			n, err := DecodedLen1X(f.src)
+			if err != nil || n != len(f.want) {
+				t.Errorf("DecodedLen1X = %d, %v, want %d", n, err, len(f.want))
+			}
+
+			// the output buffer may be larger than the output
+			for _, size := range []int{len(f.want), len(f.want) + 10} {
+				dst := make([]byte, size)
+				n, err = Decompress1X(f.src, dst)
+				if err != nil {
+					t.Fatalf("Decompress1X into %d bytes: %v", size, err)
+				}
+				if !bytes.Equal(dst[:n], f.want) {
+					t.Errorf("Decompress1X into %d bytes: %d bytes differ from %d", size, n, len(f.want))
+				}
+			}
+		})
+	}
+}
+
+func TestDecompress1XErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  []byte
+		dst  int
+		err  error
+	}{
+		{"empty", nil, 10, ErrInputOverrun},
+		{"no end marker", cat([]byte{17 + 3}, []byte("abc")), 10, ErrInputOverrun},
+		{"truncated literals", []byte{17 + 3, 'a'}, 10, ErrInputOverrun},
+		{"truncated length", []byte{0, 0, 0}, 10, ErrInputOverrun},
+		{"match before the output", cat([]byte{17 + 1}, []byte("a"), []byte{7<<5 | 1<<2, 0}, end), 10, ErrLookbehindOverrun},
+		{"M4 before the output", cat([]byte{17 + 1}, []byte("a"), []byte{16 | 1, 4, 0}, end), 10, ErrLookbehindOverrun},
+		{"small output for literals", cat([]byte{17 + 3}, []byte("abc"), end), 2, ErrOutputOverrun},
+		{"small output for a match", cat([]byte{17 + 1}, []byte("a"), []byte{7 << 5, 0}, end), 5, ErrOutputOverrun},
+		{"bytes after the end", cat([]byte{17 + 3}, []byte("abc"), end, []byte{0}), 10, ErrInputNotConsumed},
+		{"end marker of length 4", cat([]byte{17 + 3}, []byte("abc"), []byte{0x12, 0, 0}), 10, ErrDataCorrupted},
+	}
+
+	for _, tt := range tests {
+		if _, err := Decompress1X(tt.src, make([]byte, tt.dst)); err != tt.err {
+			t.Errorf("%s: Decompress1X error %v, want %v", tt.name, err, tt.err)
+		}
+		if tt.err == ErrOutputOverrun {
+			continue
+		}
+		if _, err := DecodedLen1X(tt.src); err != tt.err {
+			t.Errorf("%s: DecodedLen1X error %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestDecompress1XTruncated(t *testing.T) {
+	for _, f := range allFixtures(t) {
+		dst := make([]byte, len(f.want))
+		// every prefix of the small streams, a sample of the large ones
+		step := 1 + len(f.src)/512
+		for i := 0; i < len(f.src); i += step {
+			if _, err := Decompress1X(f.src[:i], dst); err == nil {
+				t.Errorf("%s: no Decompress1X error for %d of %d bytes", f.name, i, len(f.src))
+			}
+			if _, err := DecodedLen1X(f.src[:i]); err == nil {
+				t.Errorf("%s: no DecodedLen1X error for %d of %d bytes", f.name, i, len(f.src))
+			}
+		}
+	}
+}
+
+func TestDecompress1XCorrupt(t *testing.T) {
+	for _, f := range allFixtures(t) {
+		src := make([]byte, len(f.src))
+		dst := make([]byte, len(f.want)+64)
+		step := 1 + len(f.src)/512
+		for i := 0; i < len(f.src); i += step {
+			for _, x := range []byte{0x01, 0x10, 0x80, 0xff} {
+				copy(src, f.src)
+				src[i] ^= x
+
+				// any error but no panic, the length agrees with the output
+				n, err := Decompress1X(src, dst)
+				size, sizeErr := DecodedLen1X(src)
+				if err == nil && (n > len(dst) || sizeErr != nil || size != n) {
+					t.Errorf("%s: byte %d ^ %#x: DecodedLen1X = %d, %v, Decompress1X = %d", f.name, i, x, size, sizeErr, n)
+				}
+			}
+		}
+	}
+}
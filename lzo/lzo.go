@@ -1,3 +1,6 @@
+//go:build cgolzo
+// +build cgolzo
+
 package lzo
 
 /*
@@ -16,7 +19,6 @@ import (
 )
 
 var (
-	lzoMagic  = []byte{0x89, 0x4c, 0x5a, 0x4f, 0x00, 0x0d, 0x0a, 0x1a, 0x0a}
 	lzoErrors = []string{
 		1: "data corrupted",
 		2: "out of memory",
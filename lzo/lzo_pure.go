@@ -0,0 +1,10 @@
+//go:build !cgolzo
+// +build !cgolzo
+
+package lzo
+
+// LzoDecompress decompresses an LZO1X block, see Decompress1X. Build with
+// the cgolzo tag to use liblzo2 instead.
+func LzoDecompress(src []byte, dst []byte) (int, error) {
+	return Decompress1X(src, dst)
+}
@@ -0,0 +1,68 @@
+//go:build cgolzo
+// +build cgolzo
+
+package lzo
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+// TestDecompress1XLiblzo2 decompresses the output of liblzo2 lzo1x_1 and
+// lzo1x_999, the compressors of lzop and hadoop-lzo
+func TestDecompress1XLiblzo2(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	random := make([]byte, 100000)
+	rnd.Read(random)
+
+	// text with repeats at all distances, runs and incompressible parts
+	var text bytes.Buffer
+	for text.Len() < 200000 {
+		switch rnd.Intn(4) {
+		case 0:
+			text.WriteString("/user/hive/warehouse/table/part-00000 ")
+		case 1:
+			text.Write(bytes.Repeat([]byte{byte(rnd.Intn(256))}, rnd.Intn(1000)))
+		case 2:
+			n := rnd.Intn(3000)
+			text.Write(random[n : n+rnd.Intn(300)])
+		default:
+			if n := text.Len(); n > 50000 {
+				off := n - 1 - rnd.Intn(49000)
+				text.Write(text.Bytes()[off : off+rnd.Intn(n-off)%200])
+			}
+		}
+	}
+
+	inputs := map[string][]byte{
+		"byte":   {'a'},
+		"zeros":  make([]byte, 100000),
+		"random": random,
+		"text":   text.Bytes(),
+	}
+	for name, src := range inputs {
+		for _, level := range []string{"lzo1x_1", "lzo1x_999"} {
+			compress := lzoCompressSpeed
+			if level == "lzo1x_999" {
+				compress = lzoCompressBest
+			}
+			block, err := LzoCompress(src, compress)
+			if err != nil {
+				t.Fatalf("%s %s: %v", name, level, err)
+			}
+
+			if n, err := DecodedLen1X(block); err != nil || n != len(src) {
+				t.Errorf("%s %s: DecodedLen1X = %d, %v, want %d", name, level, n, err, len(src))
+			}
+			dst := make([]byte, len(src))
+			n, err := Decompress1X(block, dst)
+			if err != nil || !bytes.Equal(dst[:n], src) {
+				t.Errorf("%s %s: Decompress1X = %d, %v", name, level, n, err)
+			}
+			if _, err = Decompress1X(block[:len(block)-1], dst); err == nil {
+				t.Errorf("%s %s: no error for a truncated block", name, level)
+			}
+		}
+	}
+}
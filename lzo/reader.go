@@ -0,0 +1,311 @@
+package lzo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"hash/adler32"
+	"hash/crc32"
+	"io"
+	"time"
+)
+
+const (
+	flagAdler32D = 1 << 0
+	flagAdler32C = 1 << 1
+	flagCRC32D   = 1 << 8
+	flagCRC32C   = 1 << 9
+	flagFilter   = 1 << 11
+	flagCRC32    = 1 << 12
+
+	// maxBlockSize is the largest block lzop writes
+	maxBlockSize = 64 << 20
+)
+
+var (
+	lzoMagic   = []byte{0x89, 0x4c, 0x5a, 0x4f, 0x00, 0x0d, 0x0a, 0x1a, 0x0a}
+	ErrHeader  = errors.New("lzo: invalid header")
+	ErrVersion = errors.New("lzo: incompatible version")
+	ErrMethod  = errors.New("lzo: incompatible method")
+	ErrCorrupt = errors.New("lzo: data corruption")
+)
+
+type Header struct {
+	ModTime time.Time
+	Name    string
+	flags   uint32
+}
+
+// Reader decompresses an lzop stream, the format of Hadoop LzopCodec.
+type Reader struct {
+	Header
+	r       io.Reader
+	buf     [512]byte
+	block   []byte
+	data    []byte
+	hist    []byte
+	adler32 hash.Hash32
+	crc32   hash.Hash32
+	err     error
+}
+
+// NewReader reads the lzop header from r and returns a Reader of the decompressed data.
+func NewReader(r io.Reader) (*Reader, error) {
+	z := new(Reader)
+	z.r = r
+	z.adler32 = adler32.New()
+	z.crc32 = crc32.NewIEEE()
+	if err := z.readHeader(); err != nil {
+		return nil, err
+	}
+	return z, nil
+}
+
+func (z *Reader) readHeader() error {
+	_, err := io.ReadFull(z.r, z.buf[0:len(lzoMagic)])
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(z.buf[0:len(lzoMagic)], lzoMagic) {
+		return ErrHeader
+	}
+	version, err := z.readUint16()
+	if err != nil {
+		return err
+	}
+	if version < 0x0900 {
+		return ErrHeader
+	}
+	// library version
+	if _, err = z.readUint16(); err != nil {
+		return err
+	}
+	if version >= 0x0940 {
+		extractVersion, err := z.readUint16()
+		if err != nil {
+			return err
+		}
+		if extractVersion > version {
+			return ErrVersion
+		}
+		if extractVersion < 0x0900 {
+			return ErrHeader
+		}
+	}
+	method, err := z.readByte()
+	if err != nil {
+		return err
+	}
+	if version >= 0x0940 {
+		// level
+		if _, err = z.readByte(); err != nil {
+			return err
+		}
+	}
+	if z.flags, err = z.readUint32(); err != nil {
+		return err
+	}
+	if z.flags&flagFilter != 0 {
+		if _, err = z.readUint32(); err != nil {
+			return err
+		}
+	}
+	// mode
+	if _, err = z.readUint32(); err != nil {
+		return err
+	}
+	modTime, err := z.readUint32()
+	if err != nil {
+		return err
+	}
+	z.ModTime = time.Unix(int64(modTime), 0)
+	if version >= 0x0940 {
+		// high bits of mtime
+		if _, err = z.readUint32(); err != nil {
+			return err
+		}
+	}
+	if version < 0x0120 {
+		z.ModTime = time.Unix(0, 0)
+	}
+	l, err := z.readByte()
+	if err != nil {
+		return err
+	}
+	if l > 0 {
+		if _, err = io.ReadFull(z.r, z.buf[0:l]); err != nil {
+			return err
+		}
+		z.adler32.Write(z.buf[0:l])
+		z.crc32.Write(z.buf[0:l])
+		z.Name = string(z.buf[0:l])
+	}
+	var checksum uint32
+	if z.flags&flagCRC32 != 0 {
+		checksum = z.crc32.Sum32()
+	} else {
+		checksum = z.adler32.Sum32()
+	}
+	z.crc32.Reset()
+	z.adler32.Reset()
+	checksumHeader, err := z.readUint32()
+	if err != nil {
+		return err
+	}
+	if checksumHeader != checksum {
+		return ErrHeader
+	}
+	if method <= 0 {
+		return ErrMethod
+	}
+	return nil
+}
+
+func (z *Reader) readByte() (byte, error) {
+	if _, err := io.ReadFull(z.r, z.buf[0:1]); err != nil {
+		return 0, err
+	}
+	z.adler32.Write(z.buf[0:1])
+	z.crc32.Write(z.buf[0:1])
+	return z.buf[0], nil
+}
+
+func (z *Reader) readUint16() (uint16, error) {
+	if _, err := io.ReadFull(z.r, z.buf[0:2]); err != nil {
+		return 0, err
+	}
+	z.adler32.Write(z.buf[0:2])
+	z.crc32.Write(z.buf[0:2])
+	return binary.BigEndian.Uint16(z.buf[0:2]), nil
+}
+
+func (z *Reader) readUint32() (uint32, error) {
+	if _, err := io.ReadFull(z.r, z.buf[0:4]); err != nil {
+		return 0, err
+	}
+	z.adler32.Write(z.buf[0:4])
+	z.crc32.Write(z.buf[0:4])
+	return binary.BigEndian.Uint32(z.buf[0:4]), nil
+}
+
+// checksum returns adler32 or crc32 of data
+func (z *Reader) checksum(h hash.Hash32, data []byte) uint32 {
+	h.Reset()
+	h.Write(data)
+	return h.Sum32()
+}
+
+func (z *Reader) nextBlock() {
+	var dstLen uint32
+	if dstLen, z.err = z.readUint32(); z.err != nil {
+		return
+	}
+	// a zero length block ends the stream
+	if dstLen == 0 {
+		z.err = io.EOF
+		return
+	}
+	var srcLen uint32
+	if srcLen, z.err = z.readUint32(); z.err != nil {
+		return
+	}
+	if srcLen <= 0 || srcLen > dstLen || dstLen > maxBlockSize {
+		z.err = ErrCorrupt
+		return
+	}
+
+	// checksums of decompressed and compressed data, adler32 comes first
+	var dstAdler, dstCRC, srcAdler, srcCRC uint32
+	if z.flags&flagAdler32D != 0 {
+		if dstAdler, z.err = z.readUint32(); z.err != nil {
+			return
+		}
+	}
+	if z.flags&flagCRC32D != 0 {
+		if dstCRC, z.err = z.readUint32(); z.err != nil {
+			return
+		}
+	}
+	srcAdler, srcCRC = dstAdler, dstCRC
+	if z.flags&flagAdler32C != 0 && srcLen < dstLen {
+		if srcAdler, z.err = z.readUint32(); z.err != nil {
+			return
+		}
+	}
+	if z.flags&flagCRC32C != 0 && srcLen < dstLen {
+		if srcCRC, z.err = z.readUint32(); z.err != nil {
+			return
+		}
+	}
+
+	if uint32(cap(z.block)) < srcLen {
+		z.block = make([]byte, srcLen)
+	}
+	z.block = z.block[:srcLen]
+	if _, z.err = io.ReadFull(z.r, z.block); z.err != nil {
+		if z.err == io.EOF {
+			z.err = io.ErrUnexpectedEOF
+		}
+		return
+	}
+
+	if z.flags&flagAdler32C != 0 && srcAdler != z.checksum(z.adler32, z.block) {
+		z.err = ErrCorrupt
+		return
+	}
+	if z.flags&flagCRC32C != 0 && srcCRC != z.checksum(z.crc32, z.block) {
+		z.err = ErrCorrupt
+		return
+	}
+
+	// a block that does not compress is stored as is
+	if srcLen < dstLen {
+		if uint32(cap(z.data)) < dstLen {
+			z.data = make([]byte, dstLen)
+		}
+		z.data = z.data[:dstLen]
+		var n int
+		if n, z.err = LzoDecompress(z.block, z.data); z.err != nil {
+			return
+		}
+		if n != int(dstLen) {
+			z.err = ErrCorrupt
+			return
+		}
+		z.hist = z.data
+	} else {
+		z.hist = z.block
+	}
+
+	if z.flags&flagAdler32D != 0 && dstAdler != z.checksum(z.adler32, z.hist) {
+		z.err = ErrCorrupt
+		return
+	}
+	if z.flags&flagCRC32D != 0 && dstCRC != z.checksum(z.crc32, z.hist) {
+		z.err = ErrCorrupt
+		return
+	}
+}
+
+func (z *Reader) Read(p []byte) (int, error) {
+	for {
+		if len(z.hist) > 0 {
+			n := copy(p, z.hist)
+			z.hist = z.hist[n:]
+			return n, nil
+		}
+		if z.err != nil {
+			return 0, z.err
+		}
+		z.nextBlock()
+	}
+}
+
+// Close closes the Reader. It does not close the underlying io.Reader.
+func (z *Reader) Close() error {
+	if z.err == io.EOF {
+		return nil
+	}
+	return z.err
+}
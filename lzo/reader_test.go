@@ -0,0 +1,171 @@
+package lzo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/adler32"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// lzopBlock is a block of an lzop stream, data is stored as is if it is as
+// long as the decompressed data
+type lzopBlock struct {
+	data []byte
+	want []byte
+}
+
+// lzop returns an lzop stream of the blocks like lzop 1.03 writes it
+func lzop(flags uint32, blocks ...lzopBlock) []byte {
+	var h bytes.Buffer
+	for _, v := range []interface{}{
+		uint16(0x1030), uint16(0x2080), uint16(0x0940), // version, library and extract version
+		uint8(1), uint8(5), flags, // method M_LZO1X_1, level
+		uint32(0100644), uint32(1500000000), uint32(0), // mode, mtime
+		uint8(4), []byte("file"),
+	} {
+		binary.Write(&h, binary.BigEndian, v)
+	}
+	sum := adler32.Checksum(h.Bytes())
+	if flags&flagCRC32 != 0 {
+		sum = crc32.ChecksumIEEE(h.Bytes())
+	}
+	binary.Write(&h, binary.BigEndian, sum)
+
+	b := bytes.NewBuffer(append([]byte(nil), lzoMagic...))
+	b.Write(h.Bytes())
+	for _, block := range blocks {
+		binary.Write(b, binary.BigEndian, uint32(len(block.want)))
+		binary.Write(b, binary.BigEndian, uint32(len(block.data)))
+		if flags&flagAdler32D != 0 {
+			binary.Write(b, binary.BigEndian, adler32.Checksum(block.want))
+		}
+		if flags&flagCRC32D != 0 {
+			binary.Write(b, binary.BigEndian, crc32.ChecksumIEEE(block.want))
+		}
+		if flags&flagAdler32C != 0 && len(block.data) < len(block.want) {
+			binary.Write(b, binary.BigEndian, adler32.Checksum(block.data))
+		}
+		if flags&flagCRC32C != 0 && len(block.data) < len(block.want) {
+			binary.Write(b, binary.BigEndian, crc32.ChecksumIEEE(block.data))
+		}
+		b.Write(block.data)
+	}
+	binary.Write(b, binary.BigEndian, uint32(0))
+	return b.Bytes()
+}
+
+func TestReader(t *testing.T) {
+	var blocks []lzopBlock
+	var want []byte
+	for _, f := range fixtures() {
+		// lzop stores the blocks that don't compress
+		if len(f.src) < len(f.want) {
+			blocks = append(blocks, lzopBlock{f.src, f.want})
+		} else {
+			blocks = append(blocks, lzopBlock{f.want, f.want})
+		}
+		want = append(want, f.want...)
+	}
+
+	for _, flags := range []uint32{
+		0,
+		flagAdler32D | flagAdler32C,
+		flagCRC32D | flagCRC32C | flagCRC32,
+		flagAdler32D | flagCRC32D | flagAdler32C | flagCRC32C,
+	} {
+		r, err := NewReader(bytes.NewReader(lzop(flags, blocks...)))
+		if err != nil {
+			t.Fatalf("flags %#x: %v", flags, err)
+		}
+		if r.Name != "file" || r.ModTime.Unix() != 1500000000 {
+			t.Errorf("flags %#x: header %q %v", flags, r.Name, r.ModTime)
+		}
+		got, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Errorf("flags %#x: %v", flags, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("flags %#x: %d bytes differ from %d", flags, len(got), len(want))
+		}
+		if err = r.Close(); err != nil {
+			t.Errorf("flags %#x: close %v", flags, err)
+		}
+	}
+}
+
+func TestReaderFile(t *testing.T) {
+	want, err := ioutil.ReadFile("testdata/fields.c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// blocks of 4096 bytes compressed by lzo1x_999, see testdata/gen.go
+	f, err := os.Open("testdata/fields.c.lzo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	r, err := NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Name != "fields.c" || r.ModTime.Unix() != 828000000 {
+		t.Errorf("header %q %v", r.Name, r.ModTime)
+	}
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%d bytes differ from %d", len(got), len(want))
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	f := fixtures()[5]
+	stream := lzop(flagAdler32D|flagAdler32C, lzopBlock{f.src, f.want})
+	// the block starts after the magic, 25 header bytes, the name and the
+	// header checksum, the block checksums follow its two lengths
+	blockOff := len(lzoMagic) + 25 + len("file") + 4
+
+	flip := func(b []byte, off int) []byte {
+		b = append([]byte(nil), b...)
+		b[off] ^= 0xff
+		return b
+	}
+
+	tests := []struct {
+		name      string
+		stream    []byte
+		headerErr error
+		err       error
+	}{
+		{"magic", flip(stream, 1), ErrHeader, nil},
+		{"header checksum", flip(stream, blockOff-1), ErrHeader, nil},
+		{"truncated header", stream[:blockOff-2], io.ErrUnexpectedEOF, nil},
+		{"decompressed checksum", flip(stream, blockOff+8), nil, ErrCorrupt},
+		{"compressed checksum", flip(stream, blockOff+12), nil, ErrCorrupt},
+		{"decompressed data", lzop(flagAdler32D, lzopBlock{flip(f.src, 2), f.want}), nil, ErrCorrupt},
+		{"block data", lzop(0, lzopBlock{flip(f.src, len(f.src)-1), f.want}), nil, ErrLookbehindOverrun},
+		{"block longer than data", lzop(0, lzopBlock{f.src, append(f.want, 0)}), nil, ErrCorrupt},
+		{"truncated block", stream[:len(stream)-8], nil, io.ErrUnexpectedEOF},
+	}
+
+	for _, tt := range tests {
+		r, err := NewReader(bytes.NewReader(tt.stream))
+		if err != tt.headerErr {
+			t.Errorf("%s: header error %v, want %v", tt.name, err, tt.headerErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if _, err = ioutil.ReadAll(r); err != tt.err {
+			t.Errorf("%s: error %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
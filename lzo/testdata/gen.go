@@ -0,0 +1,86 @@
+//go:build ignore
+
+// gen writes the LZO1X fixtures of the tests. The inputs fields.c and sum are
+// from the Canterbury corpus, random.txt is the head of random.txt of the
+// artificial corpus and aaa is generated. The compressors are the ports of
+// lzo1x_1_compress and lzo1x_999_compress in github.com/rasky/go-lzo.
+//
+//	go run gen.go
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/adler32"
+	"io/ioutil"
+	"log"
+
+	lzo "github.com/rasky/go-lzo"
+)
+
+func main() {
+	inputs := map[string][]byte{"aaa": bytes.Repeat([]byte("a"), 100000)}
+	for _, name := range []string{"fields.c", "sum", "random.txt"} {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		inputs[name] = data
+	}
+
+	for name, data := range inputs {
+		write(name+".lzo1x_1", lzo.Compress1X(data))
+		write(name+".lzo1x_999", lzo.Compress1X999(data))
+	}
+	write("fields.c.lzo", lzop("fields.c", inputs["fields.c"], 4096))
+}
+
+func write(name string, data []byte) {
+	if err := ioutil.WriteFile(name, data, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// lzop returns an lzop 1.03 file of data in blocks of blockSize compressed by
+// lzo1x_999 (method M_LZO1X_999, level 9) with adler32 checksums of the
+// decompressed and compressed blocks
+func lzop(name string, data []byte, blockSize int) []byte {
+	const flags = 1<<0 | 1<<1 | 0x03000000 // F_ADLER32_D, F_ADLER32_C, F_OS_UNIX
+
+	var h bytes.Buffer
+	for _, v := range []interface{}{
+		uint16(0x1030), uint16(0x20a0), uint16(0x0940), // version, library and extract version
+		uint8(3), uint8(9), uint32(flags), // method, level
+		uint32(0100644), uint32(828000000), uint32(0), // mode, mtime
+		uint8(len(name)), []byte(name),
+	} {
+		binary.Write(&h, binary.BigEndian, v)
+	}
+	binary.Write(&h, binary.BigEndian, adler32.Checksum(h.Bytes()))
+
+	b := bytes.NewBuffer([]byte{0x89, 0x4c, 0x5a, 0x4f, 0x00, 0x0d, 0x0a, 0x1a, 0x0a})
+	b.Write(h.Bytes())
+	for len(data) > 0 {
+		n := blockSize
+		if n > len(data) {
+			n = len(data)
+		}
+		block := data[:n]
+		data = data[n:]
+
+		c := lzo.Compress1X999(block)
+		binary.Write(b, binary.BigEndian, uint32(len(block)))
+		if len(c) >= len(block) {
+			binary.Write(b, binary.BigEndian, uint32(len(block)))
+			binary.Write(b, binary.BigEndian, adler32.Checksum(block))
+			b.Write(block)
+			continue
+		}
+		binary.Write(b, binary.BigEndian, uint32(len(c)))
+		binary.Write(b, binary.BigEndian, adler32.Checksum(block))
+		binary.Write(b, binary.BigEndian, adler32.Checksum(c))
+		b.Write(c)
+	}
+	binary.Write(b, binary.BigEndian, uint32(0))
+	return b.Bytes()
+}
@@ -1,57 +1,64 @@
 package main
 
 import (
-	"encoding/binary"
+	"bytes"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"runtime"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/golang/protobuf/proto"
-
+	"github.com/lomik/hdfs-fsimage-dump/fsimage"
 	pb "github.com/lomik/hdfs-fsimage-dump/pb/hadoop_hdfs_fsimage"
 )
 
-const (
-	RootInodeID    = 16385
-	DetachedPrefix = "(detached)"
-	SnapshotPrefix = "(snapshot)"
-	UnknownName    = "(unknown)"
-)
-
-var Codec string
-var sectionMap map[string]*pb.FileSummary_Section
-
-var (
-	permMap = []string{
-		"---",
-		"--x",
-		"-w-",
-		"-wx",
-		"r--",
-		"r-x",
-		"rw-",
-		"rwx",
-	}
-)
-
-type IFrameReader interface {
-	ReadFrame() ([]byte, error)
-	ReadMessage(msg proto.Message) error
-	ReadUvarint() (uint64, error)
-}
-
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "info":
+			infoCommand(os.Args[2:])
+			return
+		case "inspect":
+			inspectCommand(os.Args[2:])
+			return
+		}
+	}
 
 	var extraFieldsJson map[string]interface{}
 
 	fileName := flag.String("i", "", "[mandatory]: HDFS fsimage filename")
+	processor := flag.String("p", "json", "[optional]: output processor: json, XML (the whole image like hdfs oiv -p XML) or Delimited (like hdfs oiv -p Delimited)")
+	delimiter := flag.String("delimiter", "\t", "[optional]: field delimiter of -p Delimited")
+	escape := flag.String("escape", "oiv", "[optional]: escaping of -p Delimited fields: oiv, csv or none")
 	extraFields := flag.String("extra-fields", "", "[optional]: add static json fields =\"{\\\"Data\\\":\\\"2006-01-02\\\"\"}")
 	snapReplace := flag.Bool("snap-replace", false, "[optional]: snapshots are placed into virtual directory /(snapshots)")
 	snapCleanup := flag.Bool("snap-cleanup", false, "[optional]: snapshots will contain only deleted object(s)")
+	workers := flag.Int("workers", runtime.NumCPU(), "[optional]: number of goroutines decoding and serializing inodes")
+	unordered := flag.Bool("unordered", false, "[optional]: allow output in any order, faster with many workers")
+	memStats := flag.Bool("mem-stats", false, "[optional]: print memory used by the inode tree to stderr")
+	pathCache := flag.Int("path-cache", fsimage.DefaultPathCacheSize, "[optional]: number of directory paths kept in memory, 0 disables the cache")
+	onError := flag.String("on-error", "fail", "[optional]: what to do with inconsistent inodes: fail, skip or report")
+	errorReport := flag.String("error-report", "", "[optional]: file for skipped inodes with -on-error=report (default: stderr)")
+	maxFrameSize := flag.Int64("max-frame-size", fsimage.DefaultMaxFrameSize, "[optional]: max size of one fsimage frame in bytes, larger frames are reported as broken")
+	decompressWorkers := flag.Int("decompress-workers", runtime.NumCPU(), "[optional]: number of goroutines decompressing blocks of Snappy, LZO and LZ4 images")
+	xattrInclude := flag.String("xattr-include", "", "[optional]: comma separated xattr namespaces to dump: user,trusted,security,system,raw (default: all)")
+	xattrExclude := flag.String("xattr-exclude", "", "[optional]: comma separated xattr namespaces not to dump")
+	xattrEncoding := flag.String("xattr-encoding", "text", "[optional]: encoding of xattr values: text or base64, binary values are base64 with prefix 0s in text")
+	zoneReport := flag.String("zone-report", "", "[optional]: file for the report of encryption zones with their file counts and bytes")
+	quotaReport := flag.String("quota-report", "", "[optional]: file for the report of directories with a quota like hdfs dfs -count -q")
+	quotaShare := flag.Float64("quota-share", 0.9, "[optional]: directories using this share of a quota are flagged in the quota report")
+	blocks := flag.Bool("blocks", false, "[optional]: add the Blocks array with block id, generation stamp and size to file records")
+	blocksTable := flag.String("blocks-table", "", "[optional]: file for a json line per block of every file with the inode Id as key, Id is added to file records")
+	openFilesReport := flag.String("open-files-report", "", "[optional]: file for the report of files under construction, the oldest modified first")
+	header := flag.Bool("header", false, "[optional]: write the image metadata of the info command as the first json record")
+	delimitedHeader := flag.Bool("delimited-header", false, "[optional]: write the line of column names first with -p Delimited")
+	resolveBlocksFile := flag.String("resolve-blocks", "", "[optional]: file with block ids (blk_<id> lines of fsck or logs), print the paths of their files instead of the dump")
+	spillDir := flag.String("spill-dir", "", "[optional]: low memory mode, keep the inode tree in memory mapped files in this directory")
 
 	flag.Parse()
 
@@ -67,464 +74,345 @@ func main() {
 		}
 	}
 
-	fInfo, err := os.Stat(*fileName)
-	if err != nil {
-		log.Fatal(err)
+	report := os.Stderr
+	if *errorReport != "" {
+		f, err := os.Create(*errorReport)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		report = f
 	}
 
-	f, err := os.Open(*fileName)
-	if err != nil {
+	if err := checkProcessorFlags(flag.CommandLine, *processor); err != nil {
 		log.Fatal(err)
 	}
-
-	sectionMap, Codec, err = readSummary(f, fInfo.Size())
-	if err != nil {
-		log.Fatal(err)
+	var delimited *delimitedWriter
+	if strings.EqualFold(*processor, "delimited") {
+		var err error
+		delimited, err = newDelimitedWriter(*delimiter, *escape)
+		if err != nil {
+			log.Fatal(err)
+		}
 	}
 
-	// fmt.Println(sectionMap)
-
-	tree := NewNodeTree()
-	strings := make(map[uint32]string)
-	inodeReference := NewNodeRefTree()
-
-	if err = readStrings(sectionMap["STRING_TABLE"], f, strings); err != nil {
-		log.Fatal(err)
-	}
-	if err = readReferenceTree(sectionMap["INODE_REFERENCE"], f, inodeReference); err != nil {
-		log.Fatal(err)
-	}
-	if err = readTree(sectionMap["INODE_DIR"], f, tree, inodeReference); err != nil {
-		log.Fatal(err)
-	}
-	if err = readSnapshotDiff(sectionMap["SNAPSHOT_DIFF"], f, tree, inodeReference); err != nil {
-		log.Fatal(err)
-	}
-	if err = readDirectoryNames(sectionMap["INODE"], f, tree); err != nil {
-		log.Fatal(err)
-	}
-	if err = dumpSnapshots(sectionMap["SNAPSHOT"], f, tree, snapReplace); err != nil {
-		log.Fatal(err)
-	}
-	if err = dump(sectionMap["INODE"], f, tree, strings, extraFieldsJson, snapCleanup); err != nil {
+	handler, err := errorHandler(*onError, report)
+	if err != nil {
 		log.Fatal(err)
 	}
 
-	f.Close()
-}
-
-func readSummary(imageFile *os.File, fileLength int64) (map[string]*pb.FileSummary_Section, string, error) {
-
-	_, err := imageFile.Seek(-4, 2)
+	xattrs, err := newXAttrOptions(*xattrInclude, *xattrExclude, *xattrEncoding)
 	if err != nil {
-		return nil, "", err
+		log.Fatal(err)
 	}
 
-	var summaryLength int32
-	if err = binary.Read(imageFile, binary.BigEndian, &summaryLength); err != nil {
-		return nil, "", err
+	var blockIds []uint64
+	if *resolveBlocksFile != "" {
+		var skipped []int
+		blockIds, skipped, err = readBlockIds(*resolveBlocksFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(skipped) > 0 {
+			log.Printf("%s: skipped %d lines without a block id, the first is line %d", *resolveBlocksFile, len(skipped), skipped[0])
+		}
 	}
 
-	fr, err := NewFrameReader(imageFile, fileLength-int64(summaryLength)-4, int64(summaryLength))
+	img, err := fsimage.Open(*fileName)
 	if err != nil {
-		return nil, "", err
-	}
-
-	fileSummary := &pb.FileSummary{}
-	if err = fr.ReadMessage(fileSummary); err != nil {
-		return nil, "", err
-	}
-	var codec string
-	if fileSummary.Codec == nil {
-		//fmt.Printf("readSummary codec: %v\n", "nil")
-		codec = ""
-	} else {
-		//fmt.Printf("readSummary codec: %v\n", *fileSummary.Codec)
-		codec = *fileSummary.Codec
+		log.Fatal(err)
 	}
+	img.MaxFrameSize = *maxFrameSize
+	img.DecompressWorkers = *decompressWorkers
 
-	sectionMap := make(map[string]*pb.FileSummary_Section)
-	for _, value := range fileSummary.GetSections() {
-		// fmt.Println("section", value.GetName())
-		sectionMap[value.GetName()] = value
+	if strings.EqualFold(*processor, "xml") {
+		if err = img.WriteXML(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		img.Close()
+		return
 	}
 
-	fr = nil
-	return sectionMap, codec, nil
-}
-
-func dumpSnapshots(info *pb.FileSummary_Section, imageFile *os.File, tree *NodeTree, snapReplace *bool) error {
-
-	var fr IFrameReader
-	var err error
-
-	if Codec == "" {
-		fr, err = NewFrameReader(imageFile, int64(info.GetOffset()), int64(info.GetLength()))
-	} else {
-		fr, err = NewFrameReader2(imageFile, int64(info.GetOffset()), int64(info.GetLength()), Codec)
+	if *pathCache == 0 {
+		*pathCache = -1
 	}
+	ns, err := img.LoadNamespaceWith(fsimage.NamespaceOptions{
+		SnapReplace:   *snapReplace,
+		SpillDir:      *spillDir,
+		PathCacheSize: *pathCache,
+		OnError:       handler,
+	})
 	if err != nil {
-		return err
+		log.Fatal(err)
 	}
-
-	snapshotSection := &pb.SnapshotSection{}
-	if err = fr.ReadMessage(snapshotSection); err != nil {
-		return err
+	opt := fsimage.ParallelOptions{
+		Workers:     *workers,
+		Unordered:   *unordered,
+		SnapCleanup: *snapCleanup,
+		Root:        true,
 	}
-
-	snapshot := &pb.SnapshotSection_Snapshot{}
-
-	for {
-		if err = fr.ReadMessage(snapshot); err != nil {
-			if err == io.EOF {
-				break
-			}
-			return err
-		}
-
-		if snapshot.GetRoot().Directory != nil {
-			if *snapReplace {
-				t := true
-				paths := getPaths(snapshot.GetRoot().GetId(), string(snapshot.GetRoot().GetName()), tree, true, &t)
-				snapName := fmt.Sprintf("%s/%s%s", SnapshotPrefix, string(snapshot.GetRoot().GetName()), paths[0])
-				tree.SetParentName(snapshot.GetRoot().GetId(), snapshot.GetSnapshotId(), RootInodeID, []byte(snapName))
-			} else {
-				ps := tree.GetParents(snapshot.GetRoot().GetId())
-				snapName := fmt.Sprintf("%s/.snapshot/%s", ps[0].Name, string(snapshot.GetRoot().GetName()))
-				tree.SetParentName(snapshot.GetRoot().GetId(), snapshot.GetSnapshotId(), ps[0].Parent, []byte(snapName))
-			}
+	if *resolveBlocksFile != "" {
+		if err = resolveBlocks(img, ns, blockIds, opt, os.Stdout); err != nil {
+			log.Fatal(err)
 		}
+		ns.Close()
+		img.Close()
+		return
 	}
 
-	fr = nil
-	return nil
-}
-
-func readSnapshotDiff(info *pb.FileSummary_Section, imageFile *os.File, tree *NodeTree, inodeReference *NodeRefTree) error {
-
-	var fr IFrameReader
-	var err error
-
-	if Codec == "" {
-		fr, err = NewFrameReader(imageFile, int64(info.GetOffset()), int64(info.GetLength()))
-	} else {
-		fr, err = NewFrameReader2(imageFile, int64(info.GetOffset()), int64(info.GetLength()), Codec)
-	}
-	if err != nil {
-		return err
+	if *delimitedHeader {
+		if _, err = os.Stdout.WriteString(delimited.header()); err != nil {
+			log.Fatal(err)
+		}
 	}
-
-	snapshotDiff := &pb.SnapshotDiffSection_DiffEntry{}
-	snapshotDirDiff := &pb.SnapshotDiffSection_DirectoryDiff{}
-	snapshotFileDiff := &pb.SnapshotDiffSection_FileDiff{}
-	snapshotCreatedListEntry := &pb.SnapshotDiffSection_CreatedListEntry{}
-
-	for {
-		body, err := fr.ReadFrame()
+	if *header {
+		info, err := headerRecord(img)
 		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			return err
-		}
-
-		if err = proto.Unmarshal(body, snapshotDiff); err != nil {
-			return err
+			log.Fatal(err)
 		}
-
-		for i := 0; i < int(snapshotDiff.GetNumOfDiff()); i++ {
-
-			// read and skip FILEDIFF entry
-			if snapshotDiff.GetType() == pb.SnapshotDiffSection_DiffEntry_FILEDIFF {
-				if err = fr.ReadMessage(snapshotFileDiff); err != nil {
-					return err
-				}
-				continue
-			}
-
-			body, err := fr.ReadFrame()
-			if err != nil {
-				if err == io.EOF {
-					break
-				}
-				return err
-			}
-
-			if err = proto.Unmarshal(body, snapshotDirDiff); err != nil {
-				return err
-			}
-			for _, deletedInodeRef := range snapshotDirDiff.GetDeletedINodeRef() {
-				tree.SetParent(inodeReference.GetRefId(deletedInodeRef), snapshotDirDiff.GetSnapshotId(), snapshotDiff.GetInodeId())
-				refName := inodeReference.GetRefName(deletedInodeRef)
-				if len(refName) > 0 {
-					tree.SetName(inodeReference.GetRefId(deletedInodeRef), snapshotDirDiff.GetSnapshotId(), refName)
-				}
-			}
-
-			for _, deletedInode := range snapshotDirDiff.GetDeletedINode() {
-				tree.SetParent(deletedInode, snapshotDirDiff.GetSnapshotId(), snapshotDiff.GetInodeId())
-				if len(snapshotDirDiff.GetName()) > 0 {
-					tree.SetName(deletedInode, snapshotDirDiff.GetSnapshotId(), snapshotDirDiff.GetName())
-				}
-			}
-
-			// read and skip CreatedList
-			for j := 0; j < int(snapshotDirDiff.GetCreatedListSize()); j++ {
-				if err = fr.ReadMessage(snapshotCreatedListEntry); err != nil {
-					return err
-				}
-			}
+		if err = json.NewEncoder(os.Stdout).Encode(info); err != nil {
+			log.Fatal(err)
 		}
 	}
-
-	fr = nil
-	return nil
-}
-
-func readDirectoryNames(info *pb.FileSummary_Section, imageFile *os.File, tree *NodeTree) error {
-
-	var fr IFrameReader
-	var err error
-
-	if Codec == "" {
-		fr, err = NewFrameReader(imageFile, int64(info.GetOffset()), int64(info.GetLength()))
-	} else {
-		fr, err = NewFrameReader2(imageFile, int64(info.GetOffset()), int64(info.GetLength()), Codec)
+	out := dumpOptions{
+		xattrs:    xattrs,
+		blocks:    *blocks,
+		delimited: delimited,
 	}
-	if err != nil {
-		return err
+	var zones *zoneStats
+	var counter *fsimage.ContentCounter
+	if *zoneReport != "" {
+		zones = newZoneStats()
+		out.collectors = append(out.collectors, zones.add)
 	}
-
-	inodeSection := &pb.INodeSection{}
-	if err = fr.ReadMessage(inodeSection); err != nil {
-		return err
+	if *quotaReport != "" {
+		counter = fsimage.NewContentCounter()
+		out.collectors = append(out.collectors, counter.Add)
 	}
-
-	inode := &pb.INodeSection_INode{}
-	for {
-		body, err := fr.ReadFrame()
+	var open *openFiles
+	if *openFilesReport != "" {
+		open = &openFiles{}
+		out.collectors = append(out.collectors, open.add)
+	}
+	if *blocksTable != "" {
+		f, err := os.Create(*blocksTable)
 		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			return err
-		}
-
-		// skip files without parse
-		if len(body) >= 2 && body[0] == 0x8 && body[1] == 0x1 {
-			continue
-		}
-		if err = proto.Unmarshal(body, inode); err != nil {
-			return err
-		}
-		if inode.GetDirectory() != nil {
-			tree.SetName(inode.GetId(), 0, inode.GetName())
+			log.Fatal(err)
 		}
+		out.blockTable = newBlockTable(f)
 	}
-
-	fr = nil
-	return nil
-}
-
-func readTree(info *pb.FileSummary_Section, imageFile *os.File, tree *NodeTree, inodeReference *NodeRefTree) error {
-
-	var fr IFrameReader
-	var err error
-
-	if Codec == "" {
-		fr, err = NewFrameReader(imageFile, int64(info.GetOffset()), int64(info.GetLength()))
-	} else {
-		fr, err = NewFrameReader2(imageFile, int64(info.GetOffset()), int64(info.GetLength()), Codec)
+	if err = dump(img, ns, extraFieldsJson, out, opt); err != nil {
+		log.Fatal(err)
 	}
-	if err != nil {
-		return err
+	if out.blockTable != nil {
+		if err = out.blockTable.close(); err != nil {
+			log.Fatal(err)
+		}
 	}
-
-	dirEntry := &pb.INodeDirectorySection_DirEntry{}
-	for {
-		if err = fr.ReadMessage(dirEntry); err != nil {
-			if err == io.EOF {
-				break
-			}
-			return err
+	if zones != nil {
+		err = writeReport(*zoneReport, func(w io.Writer) error {
+			return writeZoneReport(w, ns.Zones(), zones)
+		})
+		if err != nil {
+			log.Fatal(err)
 		}
-
-		children := dirEntry.GetChildren()
-		for j := 0; j < len(children); j++ {
-			tree.SetParent(children[j], 0, dirEntry.GetParent())
+	}
+	if open != nil {
+		leases, err := img.ReadFilesUnderConstruction()
+		if err != nil {
+			log.Fatal(err)
 		}
-
-		// children that are reference nodes, each element is a reference node id
-		refChildren := dirEntry.GetRefChildren()
-		for j := 0; j < len(refChildren); j++ {
-			tree.SetParent(inodeReference.GetRefId(refChildren[j]), inodeReference.GetRefSnapId(refChildren[j]), dirEntry.GetParent())
+		err = writeReport(*openFilesReport, func(w io.Writer) error {
+			return writeOpenFilesReport(w, open, leases, time.Now())
+		})
+		if err != nil {
+			log.Fatal(err)
 		}
 	}
-
-	fr = nil
-	return nil
-}
-
-func readReferenceTree(info *pb.FileSummary_Section, imageFile *os.File, inodeReference *NodeRefTree) error {
-
-	var fr IFrameReader
-	var err error
-
-	if Codec == "" {
-		fr, err = NewFrameReader(imageFile, int64(info.GetOffset()), int64(info.GetLength()))
-	} else {
-		fr, err = NewFrameReader2(imageFile, int64(info.GetOffset()), int64(info.GetLength()), Codec)
-	}
-	if err != nil {
-		return err
+	if counter != nil {
+		err = writeReport(*quotaReport, func(w io.Writer) error {
+			return writeQuotaReport(w, counter.Summaries(), *quotaShare)
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
 	}
 
-	inodeReferenceSection := &pb.INodeReferenceSection_INodeReference{}
-
-	i := uint32(0)
-	for {
-		if err = fr.ReadMessage(inodeReferenceSection); err != nil {
-			if err == io.EOF {
-				break
-			}
-			return err
-		}
-		inodeReference.SetRefSnapName(i, inodeReferenceSection.GetLastSnapshotId(),
-			inodeReferenceSection.GetReferredId(), inodeReferenceSection.GetName())
-		i++
+	if *memStats {
+		printMemStats(ns)
 	}
 
-	fr = nil
-	return nil
+	ns.Close()
+	img.Close()
 }
 
-func readStrings(info *pb.FileSummary_Section, imageFile *os.File, strings map[uint32]string) error {
-
-	var fr IFrameReader
-	var err error
+// errorHandler returns the handler of inconsistent inodes for the -on-error policy
+func errorHandler(policy string, report io.Writer) (fsimage.ErrorHandler, error) {
+	switch policy {
+	case "fail":
+		return nil, nil
+	case "skip":
+		return func(*fsimage.NodeError) error {
+			return nil
+		}, nil
+	case "report":
+		var mu sync.Mutex
+		jsonEncoder := json.NewEncoder(report)
+		return func(e *fsimage.NodeError) error {
+			mu.Lock()
+			defer mu.Unlock()
+			return jsonEncoder.Encode(map[string]interface{}{
+				"Section": e.Section,
+				"Id":      e.Id,
+				"SnapId":  e.SnapId,
+				"Name":    e.Name,
+				"Error":   e.Err.Error(),
+			})
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown -on-error policy %q", policy)
+}
 
-	if Codec == "" {
-		fr, err = NewFrameReader(imageFile, int64(info.GetOffset()), int64(info.GetLength()))
-	} else {
-		fr, err = NewFrameReader2(imageFile, int64(info.GetOffset()), int64(info.GetLength()), Codec)
-	}
+// writeReport creates fileName and writes a report into it
+func writeReport(fileName string, write func(w io.Writer) error) error {
+	f, err := os.Create(fileName)
 	if err != nil {
 		return err
 	}
-
-	stringTableSection := &pb.StringTableSection{}
-	if err = fr.ReadMessage(stringTableSection); err != nil {
+	if err = write(f); err != nil {
+		f.Close()
 		return err
 	}
-
-	entry := &pb.StringTableSection_Entry{}
-	for {
-		if err = fr.ReadMessage(entry); err != nil {
-			if err == io.EOF {
-				break
-			}
-			return err
-		}
-
-		strings[entry.GetId()] = entry.GetStr()
-	}
-
-	fr = nil
-	return nil
+	return f.Close()
 }
 
-func dump(info *pb.FileSummary_Section, imageFile *os.File, tree *NodeTree,
-	strings map[uint32]string, extraFields map[string]interface{}, snapCleanup *bool) error {
+func printMemStats(ns *fsimage.Namespace) {
+	s := ns.Tree.MemStats()
 
-	var fr IFrameReader
-	var err error
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
 
-	if Codec == "" {
-		fr, err = NewFrameReader(imageFile, int64(info.GetOffset()), int64(info.GetLength()))
-	} else {
-		fr, err = NewFrameReader2(imageFile, int64(info.GetOffset()), int64(info.GetLength()), Codec)
-	}
-	if err != nil {
-		return err
-	}
+	log.Printf("tree: inodes=%d dense=%d names=%d extra_nodes=%d extra=%d total=%d bytes_per_inode=%.1f",
+		s.Inodes, s.DenseBytes, s.NameBytes, s.ExtraNodes, s.ExtraBytes, s.TotalBytes(), s.BytesPerInode())
+	log.Printf("heap: alloc=%d sys=%d", m.HeapAlloc, m.HeapSys)
+}
 
-	inodeSection := &pb.INodeSection{}
-	if err = fr.ReadMessage(inodeSection); err != nil {
-		return err
-	}
+// dumpOptions selects optional parts of the dump
+type dumpOptions struct {
+	xattrs xattrOptions
+	// blocks adds the block list to file records
+	blocks bool
+	// blockTable gets the blocks of every file once, nil if not written
+	blockTable *blockTable
+	// delimited writes lines of -p Delimited instead of json
+	delimited *delimitedWriter
+	// collectors see every record for the reports
+	collectors []func(*fsimage.Record)
+}
 
-	inode := &pb.INodeSection_INode{}
-	jsonEncoder := json.NewEncoder(os.Stdout)
+func dump(img *fsimage.Image, ns *fsimage.Namespace, extraFields map[string]interface{}, o dumpOptions, opt fsimage.ParallelOptions) error {
+	return img.ProcessRecords(ns, opt, func(records []fsimage.Record, out *bytes.Buffer) error {
+		jsonEncoder := json.NewEncoder(out)
 
-	for {
-		if err = fr.ReadMessage(inode); err != nil {
-			if err == io.EOF {
-				break
+		// records of one inode, its blocks are written once
+		if o.blockTable != nil && records[0].Type == pb.INodeSection_INode_FILE {
+			if err := o.blockTable.write(&records[0]); err != nil {
+				return err
 			}
-			return err
 		}
 
-		if inode.File != nil {
-			isDir := false
-			paths := getPaths(inode.GetId(), string(inode.GetName()), tree, isDir, snapCleanup)
-			blocks := inode.File.GetBlocks()
-			size := uint64(0)
-			for i := 0; i < len(blocks); i++ {
-				size += blocks[i].GetNumBytes()
+		for i := range records {
+			rec := &records[i]
+
+			for _, collect := range o.collectors {
+				collect(rec)
 			}
-			perm := inode.File.GetPermission() % (1 << 16)
-			dataDump := map[string]interface{}{
-				"Replication":        inode.File.GetReplication(),
-				"ModificationTime":   time.Unix(0, int64(inode.File.GetModificationTime())*1e6).Format("2006-01-02 15:04:05"),
-				"ModificationTimeMs": inode.File.GetModificationTime(),
-				"AccessTime":         time.Unix(0, int64(inode.File.GetAccessTime())*1e6).Format("2006-01-02 15:04:05"),
-				"AccessTimeMs":       inode.File.GetAccessTime(),
-				"PreferredBlockSize": inode.File.GetPreferredBlockSize(),
-				"BlocksCount":        len(blocks),
-				"FileSize":           size,
-				"User":               strings[uint32(inode.File.GetPermission()>>40)],
-				"Group":              strings[uint32((inode.File.GetPermission()>>16)%(1<<24))],
-				"Permission":         fmt.Sprintf("-%s%s%s", permMap[(perm>>6)%8], permMap[(perm>>3)%8], permMap[(perm)%8]),
-				// "RawPermission":      inode.File.GetPermission(),
+			if o.delimited != nil {
+				o.delimited.write(out, rec)
+				continue
 			}
-			for k, v := range extraFields {
-				dataDump[k] = v
+			// the root is only counted in the reports and written by -p Delimited like oiv
+			if rec.Path == "/" {
+				continue
 			}
 
-			if len(paths) == 0 && inode.GetId() != RootInodeID {
-				paths = append(paths, fmt.Sprintf("/%s/%s", UnknownName, string(inode.GetName())))
-			}
-			for _, path := range paths {
-				dataDump["Path"] = fmt.Sprintf("%s", path)
-				jsonEncoder.Encode(dataDump)
+			var dataDump map[string]interface{}
+
+			switch rec.Type {
+			case pb.INodeSection_INode_FILE:
+				dataDump = map[string]interface{}{
+					"Replication":        rec.Replication,
+					"ModificationTime":   time.Unix(0, int64(rec.ModificationTime)*1e6).Format("2006-01-02 15:04:05"),
+					"ModificationTimeMs": rec.ModificationTime,
+					"AccessTime":         time.Unix(0, int64(rec.AccessTime)*1e6).Format("2006-01-02 15:04:05"),
+					"AccessTimeMs":       rec.AccessTime,
+					"PreferredBlockSize": rec.PreferredBlockSize,
+					"BlocksCount":        rec.BlocksCount,
+					"FileSize":           rec.FileSize,
+					"User":               rec.User,
+					"Group":              rec.Group,
+					"Permission":         rec.Permission,
+				}
+				if rec.UnderConstruction {
+					dataDump["UnderConstruction"] = true
+					dataDump["LeaseHolder"] = rec.LeaseHolder
+					dataDump["ClientMachine"] = rec.ClientMachine
+				}
+				if o.blocks {
+					dataDump["Blocks"] = blockList(rec)
+				}
+				if o.blockTable != nil {
+					dataDump["Id"] = rec.Id
+				}
+			case pb.INodeSection_INode_SYMLINK:
+				dataDump = map[string]interface{}{
+					"ModificationTime":   time.Unix(0, int64(rec.ModificationTime)*1e6).Format("2006-01-02 15:04:05"),
+					"ModificationTimeMs": rec.ModificationTime,
+					"AccessTime":         time.Unix(0, int64(rec.AccessTime)*1e6).Format("2006-01-02 15:04:05"),
+					"AccessTimeMs":       rec.AccessTime,
+					"Target":             rec.Target,
+					"User":               rec.User,
+					"Group":              rec.Group,
+					"Permission":         rec.Permission,
+				}
+			case pb.INodeSection_INode_DIRECTORY:
+				dataDump = map[string]interface{}{
+					"ModificationTime":   time.Unix(0, int64(rec.ModificationTime)*1e6).Format("2006-01-02 15:04:05"),
+					"ModificationTimeMs": rec.ModificationTime,
+					"NsQuota":            rec.NsQuota,
+					"DsQuota":            rec.DsQuota,
+					"User":               rec.User,
+					"Group":              rec.Group,
+					"Permission":         rec.Permission,
+				}
 			}
-		}
 
-		if inode.Directory != nil {
-			isDir := true
-			paths := getPaths(inode.GetId(), string(inode.GetName()), tree, isDir, snapCleanup)
-			perm := inode.Directory.GetPermission() % (1 << 16)
-			dataDump := map[string]interface{}{
-				"ModificationTime":   time.Unix(0, int64(inode.Directory.GetModificationTime())*1e6).Format("2006-01-02 15:04:05"),
-				"ModificationTimeMs": inode.Directory.GetModificationTime(),
-				"User":               strings[uint32(inode.Directory.GetPermission()>>40)],
-				"Group":              strings[uint32((inode.Directory.GetPermission()>>16)%(1<<24))],
-				"Permission":         fmt.Sprintf("d%s%s%s", permMap[(perm>>6)%8], permMap[(perm>>3)%8], permMap[(perm)%8]),
-				// "RawPermission":    inode.Directory.GetPermission(),
+			if rec.Acl != nil {
+				acl := make([]string, len(rec.Acl))
+				for i, e := range rec.Acl {
+					acl[i] = e.String()
+				}
+				dataDump["Acl"] = acl
+			}
+			if values := o.xattrs.values(rec.XAttrs); values != nil {
+				dataDump["XAttrs"] = values
+			}
+			if rec.EncryptionZone != "" {
+				dataDump["EncryptionZone"] = rec.EncryptionZone
+				dataDump["KeyName"] = rec.KeyName
 			}
+			if rec.KeyVersionName != "" {
+				dataDump["KeyVersionName"] = rec.KeyVersionName
+			}
+
 			for k, v := range extraFields {
 				dataDump[k] = v
 			}
-			if len(paths) == 0 && !*snapCleanup && inode.GetId() != RootInodeID {
-				paths = append(paths, fmt.Sprintf("/%s/%s", UnknownName, string(inode.GetName())))
-			}
-			for _, path := range paths {
-				dataDump["Path"] = fmt.Sprintf("%s", path)
-				jsonEncoder.Encode(dataDump)
+			dataDump["Path"] = rec.Path
+			if err := jsonEncoder.Encode(dataDump); err != nil {
+				return err
 			}
 		}
-	}
-
-	fr = nil
-	return nil
+		return nil
+	}, os.Stdout)
 }
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/lomik/hdfs-fsimage-dump/fsimage"
+	pb "github.com/lomik/hdfs-fsimage-dump/pb/hadoop_hdfs_fsimage"
+)
+
+func TestErrorHandler(t *testing.T) {
+	e := &fsimage.NodeError{Section: "INODE", Id: 16390, SnapId: 2, Name: "a", Err: fsimage.ErrorEmptyName}
+
+	handler, err := errorHandler("fail", nil)
+	if err != nil || handler != nil {
+		t.Errorf("fail: %v", err)
+	}
+
+	handler, err = errorHandler("skip", nil)
+	if err != nil || handler(e) != nil {
+		t.Errorf("skip: %v", err)
+	}
+
+	var report bytes.Buffer
+	handler, err = errorHandler("report", &report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = handler(e); err != nil {
+		t.Fatal(err)
+	}
+	var line map[string]interface{}
+	if err = json.Unmarshal(report.Bytes(), &line); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"Section": "INODE", "Id": 16390.0, "SnapId": 2.0, "Name": "a", "Error": "empty name"}
+	for k, v := range want {
+		if line[k] != v {
+			t.Errorf("report %s = %v, want %v", k, line[k], v)
+		}
+	}
+
+	if _, err = errorHandler("ignore", nil); err == nil {
+		t.Error("no error for an unknown policy")
+	}
+}
+
+// jsonLines decodes a report of json lines
+func jsonLines(t *testing.T, b []byte) []map[string]interface{} {
+	t.Helper()
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		var line map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("%v: %s", err, scanner.Bytes())
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// testSection is a section of testImage, data are varint delimited frames
+type testSection struct {
+	name string
+	data []byte
+}
+
+// testImage returns an image of sections, compressed with zlib for the codec
+// org.apache.hadoop.io.compress.DefaultCodec
+func testImage(t *testing.T, codec string, sections ...testSection) *fsimage.Image {
+	t.Helper()
+	var img bytes.Buffer
+	img.WriteString("HDFSIMG1")
+	summary := &pb.FileSummary{OndiskVersion: proto.Uint32(1), LayoutVersion: proto.Uint32(4294967233)}
+	if codec != "" {
+		summary.Codec = proto.String(codec)
+	}
+	for _, s := range sections {
+		data := s.data
+		if codec != "" {
+			var b bytes.Buffer
+			w := zlib.NewWriter(&b)
+			w.Write(data)
+			w.Close()
+			data = b.Bytes()
+		}
+		summary.Sections = append(summary.Sections, &pb.FileSummary_Section{
+			Name:   proto.String(s.name),
+			Offset: proto.Uint64(uint64(img.Len())),
+			Length: proto.Uint64(uint64(len(data))),
+		})
+		img.Write(data)
+	}
+	data := testFrames(t, summary)
+	img.Write(data)
+	binary.Write(&img, binary.BigEndian, int32(len(data)))
+
+	res, err := fsimage.New(bytes.NewReader(img.Bytes()), int64(img.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+// testFrames returns varint delimited messages
+func testFrames(t *testing.T, msgs ...proto.Message) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	for _, m := range msgs {
+		data, err := proto.Marshal(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.Write(proto.EncodeVarint(uint64(len(data))))
+		b.Write(data)
+	}
+	return b.Bytes()
+}
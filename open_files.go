@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lomik/hdfs-fsimage-dump/fsimage"
+)
+
+// openFiles collects current files under construction
+type openFiles struct {
+	sync.Mutex
+	files []fsimage.Record
+}
+
+func (o *openFiles) add(rec *fsimage.Record) {
+	if !rec.UnderConstruction || rec.SnapId != 0 {
+		return
+	}
+	o.Lock()
+	o.files = append(o.files, *rec)
+	o.Unlock()
+}
+
+// writeOpenFilesReport writes one json line per open file sorted by
+// modification time, so stale leases of dead writers come first. Lease is set
+// for files in leases, the FILES_UNDER_CONSTRUCTION section, and AgeSeconds
+// is the age at now.
+func writeOpenFilesReport(w io.Writer, open *openFiles, leases map[uint64]string, now time.Time) error {
+	sort.Slice(open.files, func(i, j int) bool {
+		return open.files[i].ModificationTime < open.files[j].ModificationTime
+	})
+
+	jsonEncoder := json.NewEncoder(w)
+	for i := range open.files {
+		rec := &open.files[i]
+		mtime := time.Unix(0, int64(rec.ModificationTime)*1e6)
+		_, lease := leases[rec.Id]
+		err := jsonEncoder.Encode(map[string]interface{}{
+			"Id":                 rec.Id,
+			"Path":               rec.Path,
+			"LeaseHolder":        rec.LeaseHolder,
+			"ClientMachine":      rec.ClientMachine,
+			"ModificationTime":   mtime.Format("2006-01-02 15:04:05"),
+			"ModificationTimeMs": rec.ModificationTime,
+			"AgeSeconds":         int64(now.Sub(mtime).Seconds()),
+			"FileSize":           rec.FileSize,
+			"Lease":              lease,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
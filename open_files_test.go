@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lomik/hdfs-fsimage-dump/fsimage"
+)
+
+func TestOpenFilesReport(t *testing.T) {
+	open := &openFiles{}
+	for _, rec := range []fsimage.Record{
+		{Id: 16386, Path: "/logs/new", UnderConstruction: true, LeaseHolder: "DFSClient_1", ClientMachine: "10.0.0.1", ModificationTime: 1505000300000, FileSize: 10},
+		{Id: 16387, Path: "/logs/closed", ModificationTime: 1505000000000},
+		{Id: 16388, Path: "/logs/old", UnderConstruction: true, LeaseHolder: "DFSClient_2", ClientMachine: "10.0.0.2", ModificationTime: 1505000000000},
+		{Id: 16386, Path: "/logs/.snapshot/s1/new", UnderConstruction: true, SnapId: 1, ModificationTime: 1},
+	} {
+		open.add(&rec)
+	}
+
+	now := time.Unix(1505000400, 0)
+	var b bytes.Buffer
+	if err := writeOpenFilesReport(&b, open, map[uint64]string{16388: "/logs/old"}, now); err != nil {
+		t.Fatal(err)
+	}
+
+	mtime := func(ms int64) string {
+		return time.Unix(0, ms*1e6).Format("2006-01-02 15:04:05")
+	}
+	want := []map[string]interface{}{
+		{"Id": 16388.0, "Path": "/logs/old", "LeaseHolder": "DFSClient_2", "ClientMachine": "10.0.0.2", "ModificationTime": mtime(1505000000000),
+			"ModificationTimeMs": 1505000000000.0, "AgeSeconds": 400.0, "FileSize": 0.0, "Lease": true},
+		{"Id": 16386.0, "Path": "/logs/new", "LeaseHolder": "DFSClient_1", "ClientMachine": "10.0.0.1", "ModificationTime": mtime(1505000300000),
+			"ModificationTimeMs": 1505000300000.0, "AgeSeconds": 100.0, "FileSize": 10.0, "Lease": false},
+	}
+	got := jsonLines(t, b.Bytes())
+	if len(got) != len(want) {
+		t.Fatalf("%d lines, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Errorf("line %d:\n%v\nwant\n%v", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// outputProcessor is a value of -p with the flags it has no use for
+type outputProcessor struct {
+	name    string
+	ignored []string
+}
+
+// outputProcessors are the output processors by lower case name.
+// Delimited has no columns for the json only fields and records,
+// XML writes the sections of the image as they are without loading the namespace.
+var outputProcessors = map[string]outputProcessor{
+	"json": {"json", []string{"delimited-header", "delimiter", "escape"}},
+	"delimited": {"Delimited", []string{
+		"blocks", "extra-fields", "header", "xattr-encoding", "xattr-exclude", "xattr-include",
+	}},
+	"xml": {"XML", []string{
+		"blocks", "blocks-table", "delimited-header", "delimiter", "error-report", "escape", "extra-fields",
+		"header", "mem-stats", "on-error", "open-files-report", "path-cache", "quota-report", "quota-share",
+		"resolve-blocks", "snap-cleanup", "snap-replace", "spill-dir", "unordered", "workers",
+		"xattr-encoding", "xattr-exclude", "xattr-include", "zone-report",
+	}},
+}
+
+// checkProcessorFlags returns an error if the processor is unknown or flags it
+// ignores are set in fs to other values than their defaults
+func checkProcessorFlags(fs *flag.FlagSet, processor string) error {
+	p, ok := outputProcessors[strings.ToLower(processor)]
+	if !ok {
+		return fmt.Errorf("unknown output processor %q", processor)
+	}
+	var set []string
+	fs.Visit(func(f *flag.Flag) {
+		for _, name := range p.ignored {
+			if f.Name == name && f.Value.String() != f.DefValue {
+				set = append(set, "-"+name)
+			}
+		}
+	})
+	if len(set) > 0 {
+		return fmt.Errorf("%s can't be used with -p %s", strings.Join(set, ", "), p.name)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"testing"
+)
+
+func TestCheckProcessorFlags(t *testing.T) {
+	tests := []struct {
+		args []string
+		err  string
+	}{
+		{nil, ""},
+		{[]string{"-p", "json", "-blocks", "-header", "-xattr-encoding", "base64", "-workers", "2"}, ""},
+		{[]string{"-p", "json", "-delimited-header"}, "-delimited-header can't be used with -p json"},
+		{[]string{"-p", "json", "-delimiter", ",", "-escape", "csv"}, "-delimiter, -escape can't be used with -p json"},
+		{[]string{"-p", "Delimited", "-delimited-header", "-xattr-encoding", "text", "-header=false"}, ""},
+		{[]string{"-p", "Delimited", "-blocks"}, "-blocks can't be used with -p Delimited"},
+		{[]string{"-p", "Delimited", "-header"}, "-header can't be used with -p Delimited"},
+		{[]string{"-p", "Delimited", "-xattr-include", "user", "-extra-fields", `{"a":1}`, "-xattr-encoding", "base64"},
+			"-extra-fields, -xattr-encoding, -xattr-include can't be used with -p Delimited"},
+		{[]string{"-p", "XML", "-workers", "4", "-snap-replace=false"}, ""},
+		{[]string{"-p", "xml", "-blocks"}, "-blocks can't be used with -p XML"},
+		{[]string{"-p", "XML", "-blocks-table", "b.json", "-resolve-blocks", "ids", "-header"},
+			"-blocks-table, -header, -resolve-blocks can't be used with -p XML"},
+		{[]string{"-p", "XML", "-snap-replace", "-snap-cleanup", "-xattr-exclude", "raw", "-delimited-header"},
+			"-delimited-header, -snap-cleanup, -snap-replace, -xattr-exclude can't be used with -p XML"},
+		{[]string{"-p", "XML", "-workers", "2"}, "-workers can't be used with -p XML"},
+		{[]string{"-p", "csv"}, `unknown output processor "csv"`},
+	}
+
+	for _, tt := range tests {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.SetOutput(ioutil.Discard)
+		processor := fs.String("p", "json", "")
+		fs.Int("workers", 4, "")
+		fs.Bool("delimited-header", false, "")
+		fs.String("delimiter", "\t", "")
+		fs.String("escape", "oiv", "")
+		fs.Bool("blocks", false, "")
+		fs.String("blocks-table", "", "")
+		fs.Bool("header", false, "")
+		fs.String("resolve-blocks", "", "")
+		fs.Bool("snap-replace", false, "")
+		fs.Bool("snap-cleanup", false, "")
+		fs.String("extra-fields", "", "")
+		fs.String("xattr-include", "", "")
+		fs.String("xattr-exclude", "", "")
+		fs.String("xattr-encoding", "text", "")
+		if err := fs.Parse(tt.args); err != nil {
+			t.Fatal(err)
+		}
+		err := checkProcessorFlags(fs, *processor)
+		if tt.err == "" && err != nil || tt.err != "" && (err == nil || err.Error() != tt.err) {
+			t.Errorf("%q: error %v, want %q", tt.args, err, tt.err)
+		}
+	}
+}
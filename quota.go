@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/lomik/hdfs-fsimage-dump/fsimage"
+)
+
+// writeQuotaReport writes one json line per directory with a quota with the
+// columns of hdfs dfs -count -q, OverQuota is set from share of a quota
+func writeQuotaReport(w io.Writer, summaries []*fsimage.ContentSummary, share float64) error {
+	jsonEncoder := json.NewEncoder(w)
+	for _, s := range summaries {
+		if !s.HasQuota() {
+			continue
+		}
+		line := map[string]interface{}{
+			"Quota":               "none",
+			"RemainingQuota":      "inf",
+			"SpaceQuota":          "none",
+			"RemainingSpaceQuota": "inf",
+			"DirCount":            s.DirectoryCount,
+			"FileCount":           s.FileCount,
+			"ContentSize":         s.Length,
+			"SpaceConsumed":       s.SpaceConsumed,
+			"OverQuota":           s.OverShare(share),
+			"Path":                s.Path,
+		}
+		if s.NsQuota >= 0 {
+			line["Quota"] = s.NsQuota
+			line["RemainingQuota"] = s.NsQuota - int64(s.NsConsumed())
+		}
+		if s.DsQuota >= 0 {
+			line["SpaceQuota"] = s.DsQuota
+			line["RemainingSpaceQuota"] = s.DsQuota - int64(s.SpaceConsumed)
+		}
+		if err := jsonEncoder.Encode(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/lomik/hdfs-fsimage-dump/fsimage"
+)
+
+func TestQuotaReport(t *testing.T) {
+	summaries := []*fsimage.ContentSummary{
+		{Path: "/", NsQuota: math.MaxInt64, DsQuota: -1, DirectoryCount: 3, FileCount: 4, Length: 115, SpaceConsumed: 325},
+		{Path: "/a", NsQuota: 10, DsQuota: 1000, DirectoryCount: 2, FileCount: 7, Length: 110, SpaceConsumed: 320},
+		{Path: "/a/b", NsQuota: -1, DsQuota: -1, DirectoryCount: 1, FileCount: 2, Length: 10, SpaceConsumed: 20},
+		{Path: "/c", NsQuota: -1, DsQuota: 300, DirectoryCount: 1},
+	}
+	var b bytes.Buffer
+	if err := writeQuotaReport(&b, summaries, 0.9); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []map[string]interface{}{
+		{"Path": "/", "Quota": float64(math.MaxInt64), "RemainingQuota": float64(math.MaxInt64 - 7), "SpaceQuota": "none", "RemainingSpaceQuota": "inf",
+			"DirCount": 3.0, "FileCount": 4.0, "ContentSize": 115.0, "SpaceConsumed": 325.0, "OverQuota": false},
+		{"Path": "/a", "Quota": 10.0, "RemainingQuota": 1.0, "SpaceQuota": 1000.0, "RemainingSpaceQuota": 680.0,
+			"DirCount": 2.0, "FileCount": 7.0, "ContentSize": 110.0, "SpaceConsumed": 320.0, "OverQuota": true},
+		{"Path": "/c", "Quota": "none", "RemainingQuota": "inf", "SpaceQuota": 300.0, "RemainingSpaceQuota": 300.0,
+			"DirCount": 1.0, "FileCount": 0.0, "ContentSize": 0.0, "SpaceConsumed": 0.0, "OverQuota": false},
+	}
+	got := jsonLines(t, b.Bytes())
+	if len(got) != len(want) {
+		t.Fatalf("%d lines, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Errorf("line %d:\n%v\nwant\n%v", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/lomik/hdfs-fsimage-dump/fsimage"
+	pb "github.com/lomik/hdfs-fsimage-dump/pb/hadoop_hdfs_fsimage"
+)
+
+// blockOwner is the file of a block with all its paths including snapshots
+type blockOwner struct {
+	found bool
+	id    uint64
+	paths []string
+}
+
+// readBlockIds reads block ids in file order from lines with blk_<id> or
+// blk_<id>_<genstamp> like in fsck output and datanode logs, or a plain id.
+// Other lines, like the header and the summary of fsck, are skipped and their
+// numbers returned.
+func readBlockIds(fileName string) ([]uint64, []int, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	ids, skipped, err := parseBlockIds(f)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %s", fileName, err)
+	}
+	return ids, skipped, nil
+}
+
+// parseBlockIds reads the block ids of r, see readBlockIds
+func parseBlockIds(r io.Reader) ([]uint64, []int, error) {
+	var ids []uint64
+	var skipped []int
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		found := len(ids)
+		if !strings.Contains(line, "blk_") {
+			if id, err := parseBlockId(line); err == nil {
+				ids = append(ids, id)
+			}
+		}
+		for _, part := range strings.Split(line, "blk_")[1:] {
+			// the id ends at the generation stamp or at the end of the token
+			end := 0
+			for end < len(part) && (part[end] >= '0' && part[end] <= '9' || end == 0 && part[end] == '-') {
+				end++
+			}
+			if id, err := parseBlockId(part[:end]); err == nil {
+				ids = append(ids, id)
+			}
+		}
+		if len(ids) == found {
+			skipped = append(skipped, n)
+		}
+	}
+	return ids, skipped, scanner.Err()
+}
+
+// parseBlockId parses a block id, legacy random ids may be negative
+func parseBlockId(s string) (uint64, error) {
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("bad block id %q", s)
+	}
+	return uint64(id), nil
+}
+
+// resolveBlocks finds the files of blocks in one pass over the INODE section
+// and writes a json line per block in the order of ids. The blocks are looked
+// up in the block lists of inodes, which include the files deleted but kept in
+// a snapshot. A block that only a snapshot keeps after the file was truncated
+// is listed in a FileDiff of the SNAPSHOT_DIFF section, which the vendored
+// fsimage.proto does not decode, so it has no Paths.
+func resolveBlocks(img *fsimage.Image, ns *fsimage.Namespace, ids []uint64, opt fsimage.ParallelOptions, w io.Writer) error {
+	owners := make(map[uint64]*blockOwner, len(ids))
+	for _, id := range ids {
+		owners[id] = &blockOwner{}
+	}
+
+	var mu sync.Mutex
+	err := img.ProcessRecords(ns, opt, func(records []fsimage.Record, out *bytes.Buffer) error {
+		if records[0].Type != pb.INodeSection_INode_FILE {
+			return nil
+		}
+		for _, b := range records[0].INode.GetFile().GetBlocks() {
+			owner, ok := owners[b.GetBlockId()]
+			if !ok {
+				continue
+			}
+			mu.Lock()
+			owner.found = true
+			owner.id = records[0].Id
+			for i := range records {
+				owner.paths = append(owner.paths, records[i].Path)
+			}
+			mu.Unlock()
+		}
+		return nil
+	}, ioutil.Discard)
+	if err != nil {
+		return err
+	}
+
+	jsonEncoder := json.NewEncoder(w)
+	for _, id := range ids {
+		owner := owners[id]
+		line := map[string]interface{}{
+			"Block":   fmt.Sprintf("blk_%d", int64(id)),
+			"BlockId": int64(id),
+			"Paths":   []string{},
+		}
+		if owner.found {
+			line["Id"] = owner.id
+			line["Paths"] = owner.paths
+		}
+		if err = jsonEncoder.Encode(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
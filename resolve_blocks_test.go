@@ -0,0 +1,54 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseBlockIds(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		ids     []uint64
+		skipped []int
+	}{
+		{"plain ids", "1073741825\n\n  1073741826  \n", []uint64{1073741825, 1073741826}, nil},
+		{"genstamps", "blk_1073741825_1001\nblk_1073741826\n", []uint64{1073741825, 1073741826}, nil},
+		{"legacy negative id", "blk_-9223372036854775807_1000\n-1\n", []uint64{1<<63 + 1, 1<<64 - 1}, nil},
+		{
+			"fsck",
+			"Connecting to namenode via http://nn:9870/fsck?ugi=hdfs&files=1&blocks=1&path=%2F\n" +
+				"FSCK started by hdfs from /10.0.0.1 for path / at Mon Oct 12 10:00:00 UTC 2026\n" +
+				"/data/a.bin 268435456 bytes, replicated: replication=3, 2 block(s):  OK\n" +
+				"0. BP-1-10.0.0.1-1500000000000:blk_1073741825_1001 len=134217728 Live_repl=3\n" +
+				"1. BP-1-10.0.0.1-1500000000000:blk_1073741826_1002 len=134217728 Live_repl=3\n" +
+				"\n" +
+				"Status: HEALTHY\n",
+			[]uint64{1073741825, 1073741826},
+			[]int{1, 2, 3, 7},
+		},
+		{
+			"datanode log",
+			"INFO datanode.DataNode: Deleted BP-1 blk_1073741825_1001\n" +
+				"WARN datanode.DataNode: blk_ without an id\n",
+			[]uint64{1073741825},
+			[]int{2},
+		},
+		{"bad ids", "# block ids\n12ab\nblk_-\n99999999999999999999\n", nil, []int{1, 2, 3, 4}},
+	}
+
+	for _, tt := range tests {
+		ids, skipped, err := parseBlockIds(strings.NewReader(tt.input))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(ids, tt.ids) {
+			t.Errorf("%s: ids %v, want %v", tt.name, ids, tt.ids)
+		}
+		if !reflect.DeepEqual(skipped, tt.skipped) {
+			t.Errorf("%s: skipped lines %v, want %v", tt.name, skipped, tt.skipped)
+		}
+	}
+}
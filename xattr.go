@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/lomik/hdfs-fsimage-dump/fsimage"
+)
+
+// xattrOptions selects xattr namespaces and the encoding of values in the dump
+type xattrOptions struct {
+	namespaces map[int]bool
+	encoding   string
+}
+
+func newXAttrOptions(include, exclude, encoding string) (xattrOptions, error) {
+	o := xattrOptions{
+		namespaces: make(map[int]bool),
+		encoding:   encoding,
+	}
+	if encoding != "text" && encoding != "base64" {
+		return o, fmt.Errorf("unknown -xattr-encoding %q", encoding)
+	}
+
+	parse := func(list string) ([]int, error) {
+		var res []int
+		for _, name := range strings.Split(list, ",") {
+			if name == "" {
+				continue
+			}
+			ns := -1
+			for i, n := range fsimage.XAttrNamespaces {
+				if n == name {
+					ns = i
+				}
+			}
+			if ns < 0 {
+				return nil, fmt.Errorf("unknown xattr namespace %q", name)
+			}
+			res = append(res, ns)
+		}
+		return res, nil
+	}
+
+	inc, err := parse(include)
+	if err != nil {
+		return o, err
+	}
+	exc, err := parse(exclude)
+	if err != nil {
+		return o, err
+	}
+	if len(inc) == 0 {
+		for i := range fsimage.XAttrNamespaces {
+			inc = append(inc, i)
+		}
+	}
+	for _, ns := range inc {
+		o.namespaces[ns] = true
+	}
+	for _, ns := range exc {
+		delete(o.namespaces, ns)
+	}
+	return o, nil
+}
+
+// values returns selected xattrs by full name, nil if there are none
+func (o xattrOptions) values(xattrs []fsimage.XAttr) map[string]string {
+	var res map[string]string
+	for _, x := range xattrs {
+		if !o.namespaces[x.Namespace] {
+			continue
+		}
+		if res == nil {
+			res = make(map[string]string)
+		}
+		if o.encoding == "text" && isText(x.Value) {
+			res[x.FullName()] = string(x.Value)
+		} else if o.encoding == "text" {
+			res[x.FullName()] = "0s" + base64.StdEncoding.EncodeToString(x.Value)
+		} else {
+			res[x.FullName()] = base64.StdEncoding.EncodeToString(x.Value)
+		}
+	}
+	return res
+}
+
+// isText reports whether v is UTF-8 without control characters except whitespace
+func isText(v []byte) bool {
+	if !utf8.Valid(v) {
+		return false
+	}
+	for _, r := range string(v) {
+		if unicode.IsControl(r) && r != '\t' && r != '\n' && r != '\r' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lomik/hdfs-fsimage-dump/fsimage"
+)
+
+func TestXAttrOptions(t *testing.T) {
+	tests := []struct {
+		include, exclude, encoding string
+		namespaces                 []int
+		err                        string
+	}{
+		{"", "", "text", []int{0, 1, 2, 3, 4}, ""},
+		{"user,raw", "", "base64", []int{0, 4}, ""},
+		{"", "raw,system", "text", []int{0, 1, 2}, ""},
+		{"user,,trusted", "trusted", "text", []int{0}, ""},
+		{"users", "", "text", nil, `unknown xattr namespace "users"`},
+		{"", "raw,foo", "text", nil, `unknown xattr namespace "foo"`},
+		{"", "", "hex", nil, `unknown -xattr-encoding "hex"`},
+	}
+
+	for _, tt := range tests {
+		o, err := newXAttrOptions(tt.include, tt.exclude, tt.encoding)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("%q %q %q: error %v, want %s", tt.include, tt.exclude, tt.encoding, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q %q %q: %v", tt.include, tt.exclude, tt.encoding, err)
+			continue
+		}
+		want := make(map[int]bool)
+		for _, ns := range tt.namespaces {
+			want[ns] = true
+		}
+		if !reflect.DeepEqual(o.namespaces, want) {
+			t.Errorf("%q %q: namespaces %v, want %v", tt.include, tt.exclude, o.namespaces, want)
+		}
+	}
+}
+
+func TestXAttrValues(t *testing.T) {
+	xattrs := []fsimage.XAttr{
+		{Namespace: 0, Name: "tag", Value: []byte("sales\tq3\n")},
+		{Namespace: 0, Name: "empty"},
+		{Namespace: 1, Name: "bell", Value: []byte("a\x07")},
+		{Namespace: 4, Name: "hdfs.crypto.file.encryption.info", Value: []byte{0xff, 0x00}},
+	}
+
+	tests := []struct {
+		include, encoding string
+		want              map[string]string
+	}{
+		{"", "text", map[string]string{
+			"user.tag":                             "sales\tq3\n",
+			"user.empty":                           "",
+			"trusted.bell":                         "0sYQc=",
+			"raw.hdfs.crypto.file.encryption.info": "0s/wA=",
+		}},
+		{"user,raw", "base64", map[string]string{
+			"user.tag":                             "c2FsZXMJcTMK",
+			"user.empty":                           "",
+			"raw.hdfs.crypto.file.encryption.info": "/wA=",
+		}},
+		{"security", "text", nil},
+	}
+
+	for _, tt := range tests {
+		o, err := newXAttrOptions(tt.include, "", tt.encoding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := o.values(xattrs); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q %s: %v, want %v", tt.include, tt.encoding, got, tt.want)
+		}
+	}
+}
+
+func TestIsText(t *testing.T) {
+	tests := []struct {
+		v    string
+		want bool
+	}{
+		{"", true},
+		{"plain text", true},
+		{"tab\tnew line\r\n", true},
+		{"юникод", true},
+		{"nul\x00", false},
+		{"esc\x1b[0m", false},
+		{"\xc3\x28", false},
+	}
+	for _, tt := range tests {
+		if got := isText([]byte(tt.v)); got != tt.want {
+			t.Errorf("isText(%q) = %v", tt.v, got)
+		}
+	}
+}
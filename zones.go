@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/lomik/hdfs-fsimage-dump/fsimage"
+	pb "github.com/lomik/hdfs-fsimage-dump/pb/hadoop_hdfs_fsimage"
+)
+
+// zoneStats counts current files and their bytes per encryption zone
+type zoneStats struct {
+	sync.Mutex
+	files map[string]uint64
+	bytes map[string]uint64
+}
+
+func newZoneStats() *zoneStats {
+	return &zoneStats{
+		files: make(map[string]uint64),
+		bytes: make(map[string]uint64),
+	}
+}
+
+func (z *zoneStats) add(rec *fsimage.Record) {
+	if rec.EncryptionZone == "" || rec.SnapId != 0 || rec.Type != pb.INodeSection_INode_FILE {
+		return
+	}
+	z.Lock()
+	z.files[rec.EncryptionZone]++
+	z.bytes[rec.EncryptionZone] += rec.FileSize
+	z.Unlock()
+}
+
+// writeZoneReport writes one json line per encryption zone in zones order
+func writeZoneReport(w io.Writer, zones []*fsimage.EncryptionZone, stats *zoneStats) error {
+	jsonEncoder := json.NewEncoder(w)
+	for _, z := range zones {
+		err := jsonEncoder.Encode(map[string]interface{}{
+			"Path":                  z.Path,
+			"KeyName":               z.KeyName,
+			"Suite":                 z.Suite,
+			"CryptoProtocolVersion": z.CryptoProtocolVersion,
+			"Files":                 stats.files[z.Path],
+			"Bytes":                 stats.bytes[z.Path],
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
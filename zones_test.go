@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/lomik/hdfs-fsimage-dump/fsimage"
+	pb "github.com/lomik/hdfs-fsimage-dump/pb/hadoop_hdfs_fsimage"
+)
+
+func TestZoneReport(t *testing.T) {
+	file := pb.INodeSection_INode_FILE
+	stats := newZoneStats()
+	for _, rec := range []fsimage.Record{
+		{Type: file, EncryptionZone: "/secure", FileSize: 10},
+		{Type: file, EncryptionZone: "/secure", FileSize: 5},
+		{Type: file, EncryptionZone: "/secure", FileSize: 100, SnapId: 2},
+		{Type: pb.INodeSection_INode_DIRECTORY, EncryptionZone: "/secure"},
+		{Type: file, FileSize: 7},
+		{Type: file, EncryptionZone: "/secure/nested", FileSize: 1},
+	} {
+		stats.add(&rec)
+	}
+
+	zones := []*fsimage.EncryptionZone{
+		{Path: "/empty", KeyName: "k0", Suite: "AES/CTR/NoPadding", CryptoProtocolVersion: "ENCRYPTION_ZONES"},
+		{Path: "/secure", KeyName: "k1", Suite: "AES/CTR/NoPadding", CryptoProtocolVersion: "ENCRYPTION_ZONES"},
+		{Path: "/secure/nested", KeyName: "k2", Suite: "AES/CTR/NoPadding", CryptoProtocolVersion: "ENCRYPTION_ZONES"},
+	}
+	var b bytes.Buffer
+	if err := writeZoneReport(&b, zones, stats); err != nil {
+		t.Fatal(err)
+	}
+
+	got := jsonLines(t, b.Bytes())
+	want := []map[string]interface{}{
+		{"Path": "/empty", "KeyName": "k0", "Files": 0.0, "Bytes": 0.0},
+		{"Path": "/secure", "KeyName": "k1", "Files": 2.0, "Bytes": 15.0},
+		{"Path": "/secure/nested", "KeyName": "k2", "Files": 1.0, "Bytes": 1.0},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("%d lines, want %d", len(got), len(want))
+	}
+	for i := range want {
+		want[i]["Suite"] = "AES/CTR/NoPadding"
+		want[i]["CryptoProtocolVersion"] = "ENCRYPTION_ZONES"
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Errorf("line %d: %v, want %v", i, got[i], want[i])
+		}
+	}
+}